@@ -0,0 +1,216 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/marcosgmgm/openid-decode-token/pkg/decoder"
+	"github.com/marcosgmgm/openid-decode-token/pkg/metrics"
+)
+
+// check is one verification step of a report.
+type check struct {
+	Name   string `json:"name"`
+	OK     bool   `json:"ok"`
+	Detail string `json:"detail"`
+}
+
+// report is the result of the decode command, printed as text or JSON.
+type report struct {
+	Header           map[string]interface{} `json:"header,omitempty"`
+	Payload          map[string]interface{} `json:"payload,omitempty"`
+	Checks           []check                `json:"checks"`
+	Valid            bool                   `json:"valid"`
+	Outcome          string                 `json:"outcome"`
+	Error            string                 `json:"error,omitempty"`
+	ExpiresInSeconds *int64                 `json:"expires_in_seconds,omitempty"`
+}
+
+func decodeCommand(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("decode", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	var (
+		idp        idpFlags
+		audiences  = fs.String("audience", "", "comma separated audiences, one of which the token must contain")
+		algorithms = fs.String("alg", "", "comma separated accepted signature algorithms")
+		asJSON     = fs.Bool("json", false, "print the report as JSON")
+	)
+	idp.register(fs)
+	fs.Usage = func() {
+		fmt.Fprintln(stderr, "Usage: oidc-token decode [flags] [token]")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return exitError
+	}
+	token, err := readToken(fs.Arg(0), stdin)
+	if err != nil {
+		fmt.Fprintf(stderr, "oidc-token: %v\n", err)
+		return exitError
+	}
+	manager, err := idp.manager()
+	if err != nil {
+		fmt.Fprintf(stderr, "oidc-token: %v\n", err)
+		return exitError
+	}
+	var opts []decoder.Option
+	if auds := splitList(*audiences); len(auds) > 0 {
+		opts = append(opts, decoder.WithAudiences(auds...))
+	}
+	if algs := splitList(*algorithms); len(algs) > 0 {
+		opts = append(opts, decoder.WithAlgorithms(algs...))
+	}
+	r := verify(decoder.NewJwtDecoder(manager, opts...), token, idp.realm, splitList(*audiences), time.Now())
+	if *asJSON {
+		enc := json.NewEncoder(stdout)
+		enc.SetIndent("", "  ")
+		if err = enc.Encode(r); err != nil {
+			fmt.Fprintf(stderr, "oidc-token: %v\n", err)
+			return exitError
+		}
+	} else {
+		printReport(stdout, r)
+	}
+	if !r.Valid {
+		return exitInvalid
+	}
+	return exitValid
+}
+
+// readToken returns arg, or standard input when arg is empty or "-", without
+// the surrounding blanks and "Bearer " prefix.
+func readToken(arg string, stdin io.Reader) (string, error) {
+	if len(arg) == 0 || arg == "-" {
+		b, err := ioutil.ReadAll(stdin)
+		if err != nil {
+			return "", err
+		}
+		arg = string(b)
+	}
+	token := strings.TrimSpace(arg)
+	token = strings.TrimSpace(strings.TrimPrefix(token, "Bearer "))
+	if len(token) == 0 {
+		return "", fmt.Errorf("no token given")
+	}
+	return token, nil
+}
+
+// verify decodes token without verification for display, then runs the
+// decoder and turns its verdict into checks.
+func verify(d decoder.Decoder, token, realm string, audiences []string, now time.Time) *report {
+	r := &report{}
+	claims := jwt.MapClaims{}
+	t, _, err := new(jwt.Parser).ParseUnverified(token, claims)
+	if err != nil {
+		r.Outcome = metrics.OutcomeMalformed
+		r.Error = err.Error()
+		r.Checks = append(r.Checks, check{Name: "structure", Detail: err.Error()})
+		return r
+	}
+	r.Header = t.Header
+	r.Payload = claims
+	r.Checks = append(r.Checks, check{Name: "structure", OK: true, Detail: "three base64url encoded parts"})
+
+	_, err = d.DecodeAccessTokenClaims(token, realm, jwt.MapClaims{})
+	r.Valid = err == nil
+	r.Outcome = decoder.Outcome(err)
+	if err != nil {
+		r.Error = err.Error()
+	}
+	r.Checks = append(r.Checks, signatureCheck(t, r.Outcome, err))
+	if exp, ok := numericDate(claims["exp"]); ok {
+		left := exp.Sub(now).Truncate(time.Second)
+		seconds := int64(left / time.Second)
+		r.ExpiresInSeconds = &seconds
+		if left > 0 {
+			r.Checks = append(r.Checks, check{Name: "exp", OK: true, Detail: fmt.Sprintf("expires in %s (%s)", left, exp.Format(time.RFC3339))})
+		} else {
+			r.Checks = append(r.Checks, check{Name: "exp", Detail: fmt.Sprintf("expired %s ago (%s)", -left, exp.Format(time.RFC3339))})
+		}
+	} else {
+		r.Checks = append(r.Checks, check{Name: "exp", OK: true, Detail: "no exp claim, the token never expires"})
+	}
+	if nbf, ok := numericDate(claims["nbf"]); ok {
+		if now.Before(nbf) {
+			r.Checks = append(r.Checks, check{Name: "nbf", Detail: fmt.Sprintf("not valid before %s", nbf.Format(time.RFC3339))})
+		} else {
+			r.Checks = append(r.Checks, check{Name: "nbf", OK: true, Detail: fmt.Sprintf("valid since %s", nbf.Format(time.RFC3339))})
+		}
+	}
+	if len(audiences) > 0 {
+		r.Checks = append(r.Checks, audienceCheck(claims["aud"], audiences))
+	}
+	return r
+}
+
+func signatureCheck(t *jwt.Token, outcome string, err error) check {
+	c := check{Name: "signature"}
+	switch outcome {
+	case metrics.OutcomeInvalidSignature, metrics.OutcomeInvalidAlgorithm, metrics.OutcomeKeyUnavailable, metrics.OutcomeKeyRejected, metrics.OutcomeMalformed:
+		c.Detail = err.Error()
+	default:
+		c.OK = true
+		c.Detail = fmt.Sprintf("%s signature verified with key %v", t.Method.Alg(), t.Header["kid"])
+	}
+	return c
+}
+
+func audienceCheck(aud interface{}, accepted []string) check {
+	c := check{Name: "aud"}
+	b, _ := json.Marshal(aud)
+	var got decoder.Audience
+	_ = json.Unmarshal(b, &got)
+	for _, a := range accepted {
+		if got.Contains(a) {
+			c.OK = true
+			c.Detail = fmt.Sprintf("contains %s", a)
+			return c
+		}
+	}
+	c.Detail = fmt.Sprintf("%v contains none of %v", []string(got), accepted)
+	return c
+}
+
+// numericDate reads a NumericDate claim decoded from JSON.
+func numericDate(v interface{}) (time.Time, bool) {
+	switch n := v.(type) {
+	case float64:
+		return time.Unix(int64(n), 0), true
+	case json.Number:
+		i, err := n.Int64()
+		return time.Unix(i, 0), err == nil
+	}
+	return time.Time{}, false
+}
+
+func printReport(w io.Writer, r *report) {
+	for _, part := range []struct {
+		title string
+		v     map[string]interface{}
+	}{{"Header", r.Header}, {"Payload", r.Payload}} {
+		if part.v == nil {
+			continue
+		}
+		b, _ := json.MarshalIndent(part.v, "", "  ")
+		fmt.Fprintf(w, "%s\n%s\n\n", part.title, b)
+	}
+	fmt.Fprintln(w, "Checks")
+	for _, c := range r.Checks {
+		status := "ok  "
+		if !c.OK {
+			status = "FAIL"
+		}
+		fmt.Fprintf(w, "  %s  %-9s  %s\n", status, c.Name, c.Detail)
+	}
+	if r.Valid {
+		fmt.Fprintln(w, "\nResult: valid")
+	} else {
+		fmt.Fprintf(w, "\nResult: invalid (%s)\n", r.Outcome)
+	}
+}
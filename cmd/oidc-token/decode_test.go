@@ -0,0 +1,168 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"math/big"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+// writeJWKS writes the public key of pk as a JWKS file with the kid "kid".
+func writeJWKS(t *testing.T, pk *rsa.PrivateKey) string {
+	t.Helper()
+	jwks := map[string]interface{}{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"use": "sig",
+			"alg": "RS256",
+			"kid": "kid",
+			"n":   base64.RawURLEncoding.EncodeToString(pk.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pk.E)).Bytes()),
+		}},
+	}
+	b, _ := json.Marshal(jwks)
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	if err := ioutil.WriteFile(path, b, 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func signToken(pk *rsa.PrivateKey, claims jwt.MapClaims) string {
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = "kid"
+	s, _ := token.SignedString(pk)
+	return s
+}
+
+func Test_decodeCommand(t *testing.T) {
+	pk, _ := rsa.GenerateKey(rand.Reader, 2048)
+	other, _ := rsa.GenerateKey(rand.Reader, 2048)
+	jwks := writeJWKS(t, pk)
+	now := time.Now()
+	valid := signToken(pk, jwt.MapClaims{"sub": "user", "aud": "api", "exp": now.Add(time.Hour).Unix()})
+	tests := []struct {
+		name        string
+		args        []string
+		stdin       string
+		wantCode    int
+		wantOutcome string
+		wantFailed  string
+	}{
+		{
+			name:        "valid",
+			args:        []string{"-jwks", jwks, "-audience", "api", valid},
+			wantCode:    exitValid,
+			wantOutcome: "valid",
+		},
+		{
+			name:        "token from stdin",
+			args:        []string{"-jwks", jwks},
+			stdin:       "Bearer " + valid + "\n",
+			wantCode:    exitValid,
+			wantOutcome: "valid",
+		},
+		{
+			name:        "expired",
+			args:        []string{"-jwks", jwks, signToken(pk, jwt.MapClaims{"exp": now.Add(-time.Hour).Unix()})},
+			wantCode:    exitInvalid,
+			wantOutcome: "expired",
+			wantFailed:  "exp",
+		},
+		{
+			name:        "invalid signature",
+			args:        []string{"-jwks", jwks, signToken(other, jwt.MapClaims{"exp": now.Add(time.Hour).Unix()})},
+			wantCode:    exitInvalid,
+			wantOutcome: "invalid_signature",
+			wantFailed:  "signature",
+		},
+		{
+			name:        "wrong audience",
+			args:        []string{"-jwks", jwks, "-audience", "other", valid},
+			wantCode:    exitInvalid,
+			wantOutcome: "invalid_audience",
+			wantFailed:  "aud",
+		},
+		{
+			name:        "malformed",
+			args:        []string{"-jwks", jwks, "not.a-token"},
+			wantCode:    exitInvalid,
+			wantOutcome: "malformed",
+			wantFailed:  "structure",
+		},
+		{
+			name:     "no key source",
+			args:     []string{valid},
+			wantCode: exitError,
+		},
+		{
+			name:     "no token",
+			args:     []string{"-jwks", jwks},
+			wantCode: exitError,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+			args := append([]string{"decode", "-json"}, tt.args...)
+			code := run(args, strings.NewReader(tt.stdin), &stdout, &stderr)
+			if code != tt.wantCode {
+				t.Fatalf("run() = %d, want %d, stderr %s", code, tt.wantCode, stderr.String())
+			}
+			if tt.wantCode == exitError {
+				return
+			}
+			var r report
+			if err := json.Unmarshal(stdout.Bytes(), &r); err != nil {
+				t.Fatalf("report: %v", err)
+			}
+			if r.Outcome != tt.wantOutcome {
+				t.Errorf("outcome = %s, want %s", r.Outcome, tt.wantOutcome)
+			}
+			var failed []string
+			for _, c := range r.Checks {
+				if !c.OK {
+					failed = append(failed, c.Name)
+				}
+			}
+			if strings.Join(failed, ",") != tt.wantFailed {
+				t.Errorf("failed checks = %v, want %s", failed, tt.wantFailed)
+			}
+		})
+	}
+}
+
+func Test_printReport(t *testing.T) {
+	expiresIn := int64(90)
+	r := &report{
+		Header:  map[string]interface{}{"alg": "RS256"},
+		Payload: map[string]interface{}{"sub": "user"},
+		Checks: []check{
+			{Name: "signature", OK: true, Detail: "RS256 signature verified with key kid"},
+			{Name: "exp", Detail: "expired 1m30s ago"},
+		},
+		Outcome:          "expired",
+		ExpiresInSeconds: &expiresIn,
+	}
+	var buf bytes.Buffer
+	printReport(&buf, r)
+	for _, want := range []string{
+		"Header\n{\n  \"alg\": \"RS256\"\n}",
+		"  ok    signature  RS256 signature verified with key kid\n",
+		"  FAIL  exp        expired 1m30s ago\n",
+		"Result: invalid (expired)",
+	} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("report = %q, want %q", buf.String(), want)
+		}
+	}
+}
@@ -0,0 +1,285 @@
+package main
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math/big"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/marcosgmgm/openid-decode-token/pkg/cert"
+)
+
+const certExpiryWarn = 30 * 24 * time.Hour
+
+// keyInfo describes a published key.
+type keyInfo struct {
+	Kid        string     `json:"kid"`
+	Kty        string     `json:"kty"`
+	Alg        string     `json:"alg,omitempty"`
+	Use        string     `json:"use,omitempty"`
+	Bits       int        `json:"bits,omitempty"`
+	Curve      string     `json:"crv,omitempty"`
+	Thumbprint string     `json:"thumbprint,omitempty"`
+	Subject    string     `json:"x5c_subject,omitempty"`
+	NotAfter   *time.Time `json:"x5c_not_after,omitempty"`
+	Warnings   []string   `json:"warnings,omitempty"`
+}
+
+// keyDiff compares a live key set with a snapshot, by kid.
+type keyDiff struct {
+	Added     []string `json:"added"`
+	Removed   []string `json:"removed"`
+	Changed   []string `json:"changed"`
+	Unchanged []string `json:"unchanged"`
+}
+
+type keysReport struct {
+	Keys []keyInfo `json:"keys"`
+	Diff *keyDiff  `json:"diff,omitempty"`
+}
+
+func keysCommand(args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("keys", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	var (
+		idp      idpFlags
+		snapshot = fs.String("snapshot", "", "JWKS file to compare the published keys with")
+		save     = fs.String("save", "", "write the published keys to this JWKS file")
+		asJSON   = fs.Bool("json", false, "print the report as JSON")
+	)
+	idp.register(fs)
+	fs.Usage = func() {
+		fmt.Fprintln(stderr, "Usage: oidc-token keys [flags]")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return exitError
+	}
+	keys, err := fetchKeys(&idp)
+	if err != nil {
+		fmt.Fprintf(stderr, "oidc-token: %v\n", err)
+		return exitError
+	}
+	r := &keysReport{}
+	now := time.Now()
+	for _, k := range keys {
+		r.Keys = append(r.Keys, inspectKey(k, now))
+	}
+	if len(*snapshot) > 0 {
+		saved, err := readKeys(*snapshot)
+		if err != nil {
+			fmt.Fprintf(stderr, "oidc-token: %v\n", err)
+			return exitError
+		}
+		r.Diff = diffKeys(saved, keys)
+	}
+	if len(*save) > 0 {
+		if err = writeKeys(*save, keys); err != nil {
+			fmt.Fprintf(stderr, "oidc-token: %v\n", err)
+			return exitError
+		}
+	}
+	if *asJSON {
+		enc := json.NewEncoder(stdout)
+		enc.SetIndent("", "  ")
+		if err = enc.Encode(r); err != nil {
+			fmt.Fprintf(stderr, "oidc-token: %v\n", err)
+			return exitError
+		}
+	} else {
+		printKeys(stdout, r)
+	}
+	return exitValid
+}
+
+func fetchKeys(idp *idpFlags) ([]cert.Cert, error) {
+	manager, err := idp.manager()
+	if err != nil {
+		return nil, err
+	}
+	ksm, ok := manager.(cert.KeySetManager)
+	if !ok {
+		return nil, errors.New("the manager does not list key sets")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 2*idp.timeout)
+	defer cancel()
+	return ksm.KeySet(ctx, idp.realm)
+}
+
+func readKeys(path string) ([]cert.Cert, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var jwks struct {
+		Keys []cert.Cert `json:"keys"`
+	}
+	if err = json.Unmarshal(b, &jwks); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return jwks.Keys, nil
+}
+
+func writeKeys(path string, keys []cert.Cert) error {
+	b, err := json.MarshalIndent(struct {
+		Keys []cert.Cert `json:"keys"`
+	}{keys}, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(b, '\n'), 0644)
+}
+
+// inspectKey describes k and flags what makes it weak or about to break.
+func inspectKey(k cert.Cert, now time.Time) keyInfo {
+	info := keyInfo{Kid: k.Kid, Kty: k.Kty, Alg: k.Alg, Use: k.Use, Curve: k.Crv}
+	warn := func(format string, args ...interface{}) {
+		info.Warnings = append(info.Warnings, fmt.Sprintf(format, args...))
+	}
+	if len(k.Kid) == 0 {
+		warn("no kid")
+	}
+	if tp, err := k.Thumbprint(); err == nil {
+		info.Thumbprint = tp
+	}
+	switch k.Kty {
+	case "RSA":
+		n, errN := base64.RawURLEncoding.DecodeString(k.N)
+		e, errE := base64.RawURLEncoding.DecodeString(k.E)
+		if errN != nil || errE != nil {
+			warn("invalid modulus or exponent encoding")
+			break
+		}
+		info.Bits = new(big.Int).SetBytes(n).BitLen()
+		if info.Bits < cert.DefaultMinRSABits {
+			warn("%d bit modulus, below %d", info.Bits, cert.DefaultMinRSABits)
+		}
+		if exp := new(big.Int).SetBytes(e); exp.Cmp(big.NewInt(65537)) != 0 {
+			warn("public exponent %s instead of 65537", exp)
+		}
+	case "EC":
+		if k.Crv != "P-256" && k.Crv != "P-384" && k.Crv != "P-521" {
+			warn("unsupported curve %q", k.Crv)
+		}
+	case "OKP":
+		if k.Crv != "Ed25519" && k.Crv != "Ed448" {
+			warn("unsupported curve %q", k.Crv)
+		}
+	case "oct":
+		warn("symmetric key published")
+	default:
+		warn("unknown key type %q", k.Kty)
+	}
+	if k.Alg == "none" || strings.HasPrefix(k.Alg, "HS") {
+		warn("algorithm %s", k.Alg)
+	}
+	if len(k.X5c) > 0 {
+		der, err := base64.StdEncoding.DecodeString(k.X5c[0])
+		var c *x509.Certificate
+		if err == nil {
+			c, err = x509.ParseCertificate(der)
+		}
+		if err != nil {
+			warn("invalid x5c certificate: %v", err)
+			return info
+		}
+		info.Subject = c.Subject.String()
+		notAfter := c.NotAfter
+		info.NotAfter = &notAfter
+		switch {
+		case now.After(notAfter):
+			warn("certificate expired on %s", notAfter.Format("2006-01-02"))
+		case notAfter.Sub(now) < certExpiryWarn:
+			warn("certificate expires on %s", notAfter.Format("2006-01-02"))
+		}
+	}
+	return info
+}
+
+// diffKeys tells which kids appeared, disappeared or now hold another key.
+func diffKeys(saved, live []cert.Cert) *keyDiff {
+	d := &keyDiff{}
+	before := make(map[string]cert.Cert, len(saved))
+	for _, k := range saved {
+		before[k.Kid] = k
+	}
+	for _, k := range live {
+		prev, ok := before[k.Kid]
+		delete(before, k.Kid)
+		switch {
+		case !ok:
+			d.Added = append(d.Added, k.Kid)
+		case sameKey(prev, k):
+			d.Unchanged = append(d.Unchanged, k.Kid)
+		default:
+			d.Changed = append(d.Changed, k.Kid)
+		}
+	}
+	for kid := range before {
+		d.Removed = append(d.Removed, kid)
+	}
+	sort.Strings(d.Removed)
+	return d
+}
+
+func sameKey(a, b cert.Cert) bool {
+	ta, errA := a.Thumbprint()
+	tb, errB := b.Thumbprint()
+	if errA != nil || errB != nil {
+		return a.Kty == b.Kty && a.N == b.N && a.E == b.E && a.X == b.X && a.Y == b.Y
+	}
+	return ta == tb
+}
+
+func printKeys(w io.Writer, r *keysReport) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "KID\tKTY\tALG\tUSE\tSIZE\tTHUMBPRINT\tX5C EXPIRY")
+	for _, k := range r.Keys {
+		size := k.Curve
+		if k.Bits > 0 {
+			size = fmt.Sprintf("%d", k.Bits)
+		}
+		expiry := "-"
+		if k.NotAfter != nil {
+			expiry = k.NotAfter.Format("2006-01-02")
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", orDash(k.Kid), k.Kty, orDash(k.Alg), orDash(k.Use), orDash(size), orDash(k.Thumbprint), expiry)
+	}
+	tw.Flush()
+	for _, k := range r.Keys {
+		if len(k.Subject) > 0 {
+			fmt.Fprintf(w, "\n%s: x5c subject %s", k.Kid, k.Subject)
+		}
+		for _, warning := range k.Warnings {
+			fmt.Fprintf(w, "\nWARNING %s: %s", k.Kid, warning)
+		}
+	}
+	fmt.Fprintln(w)
+	if r.Diff == nil {
+		return
+	}
+	fmt.Fprintln(w, "\nCompared with the snapshot")
+	for _, part := range []struct {
+		label string
+		kids  []string
+	}{{"added", r.Diff.Added}, {"removed", r.Diff.Removed}, {"changed", r.Diff.Changed}, {"unchanged", r.Diff.Unchanged}} {
+		fmt.Fprintf(w, "  %-9s  %s\n", part.label, orDash(strings.Join(part.kids, ", ")))
+	}
+}
+
+func orDash(s string) string {
+	if len(s) == 0 {
+		return "-"
+	}
+	return s
+}
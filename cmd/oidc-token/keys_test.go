@@ -0,0 +1,152 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/marcosgmgm/openid-decode-token/pkg/cert"
+)
+
+func rsaCert(kid string, pk *rsa.PrivateKey) cert.Cert {
+	return cert.Cert{
+		Kty: "RSA",
+		Use: "sig",
+		Alg: "RS256",
+		Kid: kid,
+		N:   base64.RawURLEncoding.EncodeToString(pk.N.Bytes()),
+		E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pk.E)).Bytes()),
+	}
+}
+
+func selfSigned(t *testing.T, pk *rsa.PrivateKey, notAfter time.Time) string {
+	t.Helper()
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "idp"},
+		NotBefore:    notAfter.Add(-365 * 24 * time.Hour),
+		NotAfter:     notAfter,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &pk.PublicKey, pk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return base64.StdEncoding.EncodeToString(der)
+}
+
+func Test_inspectKey(t *testing.T) {
+	now := time.Now()
+	strong, _ := rsa.GenerateKey(rand.Reader, 2048)
+	weak, _ := rsa.GenerateKey(rand.Reader, 1024)
+	expiring := rsaCert("expiring", strong)
+	expiring.X5c = []string{selfSigned(t, strong, now.Add(24*time.Hour))}
+	smallE := rsaCert("small-e", strong)
+	smallE.E = "Aw"
+	tests := []struct {
+		name         string
+		key          cert.Cert
+		wantBits     int
+		wantWarnings []string
+	}{
+		{
+			name:     "strong",
+			key:      rsaCert("strong", strong),
+			wantBits: 2048,
+		},
+		{
+			name:         "short modulus",
+			key:          rsaCert("weak", weak),
+			wantBits:     1024,
+			wantWarnings: []string{"1024 bit modulus, below 2048"},
+		},
+		{
+			name:         "small exponent",
+			key:          smallE,
+			wantBits:     2048,
+			wantWarnings: []string{"public exponent 3 instead of 65537"},
+		},
+		{
+			name:         "certificate about to expire",
+			key:          expiring,
+			wantBits:     2048,
+			wantWarnings: []string{"certificate expires on " + now.Add(24*time.Hour).UTC().Format("2006-01-02")},
+		},
+		{
+			name:         "unknown curve",
+			key:          cert.Cert{Kty: "EC", Kid: "ec", Crv: "secp256k1", X: "x", Y: "y"},
+			wantWarnings: []string{"unsupported curve \"secp256k1\""},
+		},
+		{
+			name:         "symmetric key",
+			key:          cert.Cert{Kty: "oct", Alg: "HS256"},
+			wantWarnings: []string{"no kid", "symmetric key published", "algorithm HS256"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := inspectKey(tt.key, now)
+			if got.Bits != tt.wantBits {
+				t.Errorf("bits = %d, want %d", got.Bits, tt.wantBits)
+			}
+			if !reflect.DeepEqual(got.Warnings, tt.wantWarnings) {
+				t.Errorf("warnings = %q, want %q", got.Warnings, tt.wantWarnings)
+			}
+		})
+	}
+}
+
+func Test_keysCommand(t *testing.T) {
+	old, _ := rsa.GenerateKey(rand.Reader, 2048)
+	current, _ := rsa.GenerateKey(rand.Reader, 2048)
+	next, _ := rsa.GenerateKey(rand.Reader, 2048)
+	dir := t.TempDir()
+	snapshot := filepath.Join(dir, "snapshot.json")
+	if err := writeKeys(snapshot, []cert.Cert{rsaCert("old", old), rsaCert("current", current), rsaCert("rotated", old)}); err != nil {
+		t.Fatal(err)
+	}
+	live := filepath.Join(dir, "live.json")
+	if err := writeKeys(live, []cert.Cert{rsaCert("current", current), rsaCert("rotated", next), rsaCert("next", next)}); err != nil {
+		t.Fatal(err)
+	}
+	saved := filepath.Join(dir, "saved.json")
+
+	var stdout, stderr bytes.Buffer
+	code := run([]string{"keys", "-jwks", live, "-snapshot", snapshot, "-save", saved, "-json"}, nil, &stdout, &stderr)
+	if code != exitValid {
+		t.Fatalf("run() = %d, stderr %s", code, stderr.String())
+	}
+	var r keysReport
+	if err := json.Unmarshal(stdout.Bytes(), &r); err != nil {
+		t.Fatalf("report: %v", err)
+	}
+	if len(r.Keys) != 3 || r.Keys[0].Thumbprint == "" {
+		t.Errorf("keys = %+v", r.Keys)
+	}
+	want := &keyDiff{Added: []string{"next"}, Removed: []string{"old"}, Changed: []string{"rotated"}, Unchanged: []string{"current"}}
+	if !reflect.DeepEqual(r.Diff, want) {
+		t.Errorf("diff = %+v, want %+v", r.Diff, want)
+	}
+	if keys, err := readKeys(saved); err != nil || len(keys) != 3 {
+		t.Errorf("saved snapshot = %v, %v", keys, err)
+	}
+
+	stdout.Reset()
+	if code = run([]string{"keys", "-jwks", live, "-snapshot", saved}, nil, &stdout, &stderr); code != exitValid {
+		t.Fatalf("run() = %d, stderr %s", code, stderr.String())
+	}
+	for _, want := range []string{"KID", "current", "added      -", "unchanged  current, rotated, next"} {
+		if !strings.Contains(stdout.String(), want) {
+			t.Errorf("output = %q, want %q", stdout.String(), want)
+		}
+	}
+}
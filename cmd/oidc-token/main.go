@@ -0,0 +1,123 @@
+// Command oidc-token decodes and verifies access tokens locally, so that
+// production tokens never have to be pasted into a website.
+//
+// Usage:
+//
+//	oidc-token decode -base-url https://idm.base.path -realm realm [token]
+//	oidc-token decode -jwks keys.json [token]
+//	oidc-token keys -base-url https://idm.base.path -realm realm [-snapshot keys.json]
+//
+// The token is read from standard input when it is not given, which keeps it
+// out of the shell history. The exit status is 0 for a valid token, 1 for an
+// invalid one and 2 when the command could not run.
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/marcosgmgm/openid-decode-token/pkg/cert"
+)
+
+const (
+	exitValid   = 0
+	exitInvalid = 1
+	exitError   = 2
+)
+
+const usage = `Usage: oidc-token <command> [flags]
+
+Commands:
+  decode   decode a token and verify its signature and claims
+  keys     list the keys of a realm and compare them with a snapshot
+
+Run "oidc-token <command> -h" for the flags of a command.
+`
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	if len(args) == 0 {
+		fmt.Fprint(stderr, usage)
+		return exitError
+	}
+	switch args[0] {
+	case "decode":
+		return decodeCommand(args[1:], stdin, stdout, stderr)
+	case "keys":
+		return keysCommand(args[1:], stdout, stderr)
+	case "help", "-h", "-help", "--help":
+		fmt.Fprint(stdout, usage)
+		return exitValid
+	}
+	fmt.Fprintf(stderr, "oidc-token: unknown command %q\n\n%s", args[0], usage)
+	return exitError
+}
+
+var layouts = map[string]cert.Layout{
+	"keycloak": cert.KeycloakLayout,
+	"single":   cert.SingleIssuerLayout,
+	"auth0":    cert.Auth0Layout,
+	"okta":     cert.OktaLayout,
+	"oauth":    cert.OAuthServerLayout,
+}
+
+// idpFlags locate the keys of a realm, at an identity provider or in a file.
+type idpFlags struct {
+	baseURL      string
+	realm        string
+	layout       string
+	jwksFile     string
+	insecureHTTP bool
+	timeout      time.Duration
+}
+
+func (f *idpFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&f.baseURL, "base-url", "", "base path of the identity provider, such as https://host/realms")
+	fs.StringVar(&f.realm, "realm", "", "realm of the token")
+	fs.StringVar(&f.layout, "layout", "keycloak", "discovery layout: keycloak, single, auth0, okta or oauth")
+	fs.StringVar(&f.jwksFile, "jwks", "", "read the keys from a local JWKS file instead of the identity provider")
+	fs.BoolVar(&f.insecureHTTP, "insecure-http", false, "accept an identity provider over plain http")
+	fs.DurationVar(&f.timeout, "timeout", 10*time.Second, "timeout of each request to the identity provider")
+}
+
+func (f *idpFlags) manager() (cert.Manager, error) {
+	if len(f.jwksFile) > 0 {
+		file, err := os.Open(f.jwksFile)
+		if err != nil {
+			return nil, err
+		}
+		defer file.Close()
+		return cert.NewJWKSManager(file)
+	}
+	if len(f.baseURL) == 0 {
+		return nil, errors.New("either -base-url or -jwks is required")
+	}
+	layout, ok := layouts[f.layout]
+	if !ok {
+		return nil, fmt.Errorf("unknown layout %q", f.layout)
+	}
+	opts := []cert.Option{cert.WithLayout(layout), cert.WithRequestTimeout(f.timeout)}
+	if f.insecureHTTP {
+		opts = append(opts, cert.WithInsecureHTTP())
+	}
+	return cert.NewCertManager(f.baseURL, cert.NewHTTPClient(), opts...), nil
+}
+
+// splitList splits a comma separated flag value.
+func splitList(s string) []string {
+	var out []string
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); len(v) > 0 {
+			out = append(out, v)
+		}
+	}
+	return out
+}
@@ -1,25 +1,45 @@
 package cert
 
 import (
+	"context"
+	"crypto"
 	"crypto/rsa"
 	"net/http"
 )
 
 type Cert struct {
-	Kty string   `json:"kty"`
-	Use string   `json:"use"`
-	Kid string   `json:"kid"`
-	X5t string   `json:"x5t"`
-	N   string   `json:"n"`
-	E   string   `json:"e"`
-	X5c []string `json:"x5c"`
+	Kty     string   `json:"kty"`
+	Use     string   `json:"use"`
+	Alg     string   `json:"alg,omitempty"`
+	Kid     string   `json:"kid"`
+	X5t     string   `json:"x5t"`
+	N       string   `json:"n"`
+	E       string   `json:"e"`
+	X5c     []string `json:"x5c"`
+	X5tS256 string   `json:"x5t#S256"`
+	Crv     string   `json:"crv,omitempty"`
+	X       string   `json:"x,omitempty"`
+	Y       string   `json:"y,omitempty"`
 }
 
 type HttpClient interface {
 	Do(req *http.Request) (*http.Response, error)
 }
 
+// KeySetManager is implemented by managers that list every key a realm
+// publishes, its JWKS, such as the ones returned by NewCertManager and
+// NewStaticManager.
+type KeySetManager interface {
+	KeySet(ctx context.Context, realm string) ([]Cert, error)
+}
+
+// KeyManager is implemented by managers that build EC keys as well as RSA
+// ones, such as the ones returned by NewCertManager and NewStaticManager.
+type KeyManager interface {
+	Key(cert *Cert) (crypto.PublicKey, error)
+}
+
 type Manager interface {
 	Cert(kid, realm string) (*Cert, error)
 	PublicKey(cert *Cert) (*rsa.PublicKey, error)
-}
\ No newline at end of file
+}
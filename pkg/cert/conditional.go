@@ -0,0 +1,57 @@
+package cert
+
+import (
+	"encoding/json"
+	"sync"
+)
+
+// cachedResponse is the body of a discovery or JWKS response together with
+// the validators needed to revalidate it.
+type cachedResponse struct {
+	etag         string
+	lastModified string
+	body         []byte
+}
+
+// responseCache remembers the last response of every URL that carried an
+// ETag or Last-Modified header, so the next request can be conditional.
+type responseCache struct {
+	mu      sync.RWMutex
+	entries map[string]*cachedResponse
+}
+
+func newResponseCache() *responseCache {
+	return &responseCache{entries: make(map[string]*cachedResponse)}
+}
+
+func (rc *responseCache) lookup(rawURL string) *cachedResponse {
+	rc.mu.RLock()
+	defer rc.mu.RUnlock()
+	return rc.entries[rawURL]
+}
+
+func (rc *responseCache) store(rawURL string, entry *cachedResponse) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	rc.entries[rawURL] = entry
+}
+
+// primeFromDisk seeds the response cache with the key set persisted by a
+// previous process, so the first JWKS request after a restart is already
+// conditional.
+func (cm certManager) primeFromDisk(realm, jwksURI string) {
+	if cm.responses.lookup(jwksURI) != nil {
+		return
+	}
+	ks, ok := cm.diskCache.latest(realm)
+	if !ok || ks.JWKSURI != jwksURI || len(ks.ETag) == 0 {
+		return
+	}
+	body, err := json.Marshal(struct {
+		Keys []Cert `json:"keys"`
+	}{Keys: ks.Keys})
+	if err != nil {
+		return
+	}
+	cm.responses.store(jwksURI, &cachedResponse{etag: ks.ETag, body: body})
+}
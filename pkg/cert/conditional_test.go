@@ -0,0 +1,93 @@
+package cert
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"testing"
+	"time"
+)
+
+const (
+	confLastModified = "Mon, 02 Jan 2006 15:04:05 GMT"
+	jwksETag         = `"jwks-v1"`
+)
+
+// conditionalIdP answers like an identity provider honouring conditional
+// requests and records the headers it received.
+type conditionalIdP struct {
+	fullResponses int
+	notModified   int
+	ifNoneMatch   []string
+}
+
+func (c *conditionalIdP) client() HttpClient {
+	return &HttpClientCustomMock{
+		DoMock: func(req *http.Request) (*http.Response, error) {
+			if req.URL.Path == "test/test/.well-known/openid-configuration" {
+				if req.Header.Get("If-Modified-Since") == confLastModified {
+					c.notModified++
+					return &http.Response{StatusCode: http.StatusNotModified}, nil
+				}
+				c.fullResponses++
+				return &http.Response{
+					StatusCode: http.StatusOK,
+					Header:     http.Header{"Content-Type": []string{"application/json"}, "Last-Modified": []string{confLastModified}},
+					Body:       ioutil.NopCloser(bytes.NewBufferString(respConfiguration)),
+				}, nil
+			}
+			c.ifNoneMatch = append(c.ifNoneMatch, req.Header.Get("If-None-Match"))
+			if req.Header.Get("If-None-Match") == jwksETag {
+				c.notModified++
+				return &http.Response{StatusCode: http.StatusNotModified}, nil
+			}
+			c.fullResponses++
+			return &http.Response{
+				StatusCode: http.StatusOK,
+				Header:     http.Header{"Content-Type": []string{"application/json"}, "Etag": []string{jwksETag}},
+				Body:       ioutil.NopCloser(bytes.NewBufferString(respCerts)),
+			}, nil
+		},
+	}
+}
+
+func Test_certManager_ConditionalRequests(t *testing.T) {
+	idp := &conditionalIdP{}
+	cm := NewCertManager("test", idp.client(), append(testIdP, WithDiscoveryTTL(0), WithKeySetTTL(0))...)
+	for i := 0; i < 3; i++ {
+		got, err := cm.Cert(keycloakKid, "test")
+		if err != nil {
+			t.Fatalf("Cert() error = %v", err)
+		}
+		if got.Kid != keycloakKid {
+			t.Fatalf("Cert() got = %v, want %v", got.Kid, keycloakKid)
+		}
+	}
+	if idp.fullResponses != 2 {
+		t.Errorf("full responses = %d, want 2", idp.fullResponses)
+	}
+	if idp.notModified != 4 {
+		t.Errorf("not modified responses = %d, want 4", idp.notModified)
+	}
+}
+
+func Test_certManager_ConditionalRequestsAfterRestart(t *testing.T) {
+	dir, err := ioutil.TempDir("", "jwks-cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if _, err = NewCertManager("test", (&conditionalIdP{}).client(), append(testIdP, WithDiskCache(dir, time.Hour))...).Cert(keycloakKid, "test"); err != nil {
+		t.Fatalf("Cert() error = %v", err)
+	}
+
+	idp := &conditionalIdP{}
+	restarted := NewCertManager("test", idp.client(), append(testIdP, WithDiskCache(dir, time.Hour))...)
+	if _, err = restarted.Cert(keycloakKid, "test"); err != nil {
+		t.Fatalf("Cert() error = %v", err)
+	}
+	if len(idp.ifNoneMatch) != 1 || idp.ifNoneMatch[0] != jwksETag {
+		t.Errorf("If-None-Match = %v, want %v", idp.ifNoneMatch, jwksETag)
+	}
+}
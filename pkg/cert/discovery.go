@@ -0,0 +1,159 @@
+package cert
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/marcosgmgm/openid-decode-token/internal/instrument"
+	"github.com/marcosgmgm/openid-decode-token/pkg/metrics"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const defaultDiscoveryTTL = time.Hour
+
+var (
+	ErrIssuerMismatch = errors.New("discovered issuer does not match the requested issuer")
+	ErrMissingJWKSURI = errors.New("discovery document has no jwks_uri")
+)
+
+// ProviderMetadata is the OpenID Provider metadata of OpenID Connect
+// Discovery 1.0, with the additions of RFC 8414 and RFC 8705.
+type ProviderMetadata struct {
+	Issuer                                     string            `json:"issuer"`
+	AuthorizationEndpoint                      string            `json:"authorization_endpoint,omitempty"`
+	TokenEndpoint                              string            `json:"token_endpoint,omitempty"`
+	UserinfoEndpoint                           string            `json:"userinfo_endpoint,omitempty"`
+	JWKSURI                                    string            `json:"jwks_uri,omitempty"`
+	RegistrationEndpoint                       string            `json:"registration_endpoint,omitempty"`
+	IntrospectionEndpoint                      string            `json:"introspection_endpoint,omitempty"`
+	RevocationEndpoint                         string            `json:"revocation_endpoint,omitempty"`
+	EndSessionEndpoint                         string            `json:"end_session_endpoint,omitempty"`
+	CheckSessionIframe                         string            `json:"check_session_iframe,omitempty"`
+	DeviceAuthorizationEndpoint                string            `json:"device_authorization_endpoint,omitempty"`
+	PushedAuthorizationRequestEndpoint         string            `json:"pushed_authorization_request_endpoint,omitempty"`
+	ScopesSupported                            []string          `json:"scopes_supported,omitempty"`
+	ResponseTypesSupported                     []string          `json:"response_types_supported,omitempty"`
+	ResponseModesSupported                     []string          `json:"response_modes_supported,omitempty"`
+	GrantTypesSupported                        []string          `json:"grant_types_supported,omitempty"`
+	ACRValuesSupported                         []string          `json:"acr_values_supported,omitempty"`
+	SubjectTypesSupported                      []string          `json:"subject_types_supported,omitempty"`
+	IDTokenSigningAlgValuesSupported           []string          `json:"id_token_signing_alg_values_supported,omitempty"`
+	IDTokenEncryptionAlgValuesSupported        []string          `json:"id_token_encryption_alg_values_supported,omitempty"`
+	IDTokenEncryptionEncValuesSupported        []string          `json:"id_token_encryption_enc_values_supported,omitempty"`
+	UserinfoSigningAlgValuesSupported          []string          `json:"userinfo_signing_alg_values_supported,omitempty"`
+	UserinfoEncryptionAlgValuesSupported       []string          `json:"userinfo_encryption_alg_values_supported,omitempty"`
+	UserinfoEncryptionEncValuesSupported       []string          `json:"userinfo_encryption_enc_values_supported,omitempty"`
+	RequestObjectSigningAlgValuesSupported     []string          `json:"request_object_signing_alg_values_supported,omitempty"`
+	RequestObjectEncryptionAlgValuesSupported  []string          `json:"request_object_encryption_alg_values_supported,omitempty"`
+	RequestObjectEncryptionEncValuesSupported  []string          `json:"request_object_encryption_enc_values_supported,omitempty"`
+	TokenEndpointAuthMethodsSupported          []string          `json:"token_endpoint_auth_methods_supported,omitempty"`
+	TokenEndpointAuthSigningAlgValuesSupported []string          `json:"token_endpoint_auth_signing_alg_values_supported,omitempty"`
+	IntrospectionEndpointAuthMethodsSupported  []string          `json:"introspection_endpoint_auth_methods_supported,omitempty"`
+	RevocationEndpointAuthMethodsSupported     []string          `json:"revocation_endpoint_auth_methods_supported,omitempty"`
+	CodeChallengeMethodsSupported              []string          `json:"code_challenge_methods_supported,omitempty"`
+	DisplayValuesSupported                     []string          `json:"display_values_supported,omitempty"`
+	ClaimTypesSupported                        []string          `json:"claim_types_supported,omitempty"`
+	ClaimsSupported                            []string          `json:"claims_supported,omitempty"`
+	ClaimsLocalesSupported                     []string          `json:"claims_locales_supported,omitempty"`
+	UILocalesSupported                         []string          `json:"ui_locales_supported,omitempty"`
+	ServiceDocumentation                       string            `json:"service_documentation,omitempty"`
+	OPPolicyURI                                string            `json:"op_policy_uri,omitempty"`
+	OPTosURI                                   string            `json:"op_tos_uri,omitempty"`
+	ClaimsParameterSupported                   bool              `json:"claims_parameter_supported,omitempty"`
+	RequestParameterSupported                  bool              `json:"request_parameter_supported,omitempty"`
+	RequestURIParameterSupported               bool              `json:"request_uri_parameter_supported,omitempty"`
+	RequireRequestURIRegistration              bool              `json:"require_request_uri_registration,omitempty"`
+	FrontchannelLogoutSupported                bool              `json:"frontchannel_logout_supported,omitempty"`
+	BackchannelLogoutSupported                 bool              `json:"backchannel_logout_supported,omitempty"`
+	TLSClientCertificateBoundAccessTokens      bool              `json:"tls_client_certificate_bound_access_tokens,omitempty"`
+	MTLSEndpointAliases                        map[string]string `json:"mtls_endpoint_aliases,omitempty"`
+}
+
+// Discoverer is implemented by managers that read the provider metadata,
+// such as the one returned by NewCertManager.
+type Discoverer interface {
+	Discover(ctx context.Context, realm string) (*ProviderMetadata, error)
+}
+
+type discovery struct {
+	metadata  *ProviderMetadata
+	fetchedAt time.Time
+}
+
+// discoveryCache keeps the metadata of each realm for ttl.
+type discoveryCache struct {
+	ttl     time.Duration
+	mu      sync.RWMutex
+	entries map[string]discovery
+}
+
+func newDiscoveryCache(ttl time.Duration) *discoveryCache {
+	return &discoveryCache{ttl: ttl, entries: make(map[string]discovery)}
+}
+
+func (dc *discoveryCache) lookup(realm string) (*ProviderMetadata, bool) {
+	dc.mu.RLock()
+	defer dc.mu.RUnlock()
+	d, ok := dc.entries[realm]
+	if !ok || dc.ttl <= 0 || time.Since(d.fetchedAt) > dc.ttl {
+		return nil, false
+	}
+	return d.metadata, true
+}
+
+func (dc *discoveryCache) store(realm string, md *ProviderMetadata) {
+	dc.mu.Lock()
+	defer dc.mu.Unlock()
+	dc.entries[realm] = discovery{metadata: md, fetchedAt: time.Now()}
+}
+
+// WithDiscoveryTTL sets how long the provider metadata of a realm is reused
+// before it is requested again, one hour by default. A zero ttl requests it
+// on every key lookup.
+func WithDiscoveryTTL(ttl time.Duration) Option {
+	return func(cm *certManager) {
+		cm.discoveries = newDiscoveryCache(ttl)
+	}
+}
+
+// WithoutIssuerCheck accepts provider metadata whose issuer differs from the
+// one of the layout, for providers reached through an internal address. The
+// discovered jwks_uri must still live on the host of the layout issuer, or on
+// one allowed with WithAllowedJWKSHosts.
+func WithoutIssuerCheck() Option {
+	return func(cm *certManager) {
+		cm.skipIssuerCheck = true
+	}
+}
+
+// Discover returns the provider metadata of the realm. The issuer of the
+// document must be exactly the issuer the layout expects for the realm
+// (OpenID Connect Discovery 1.0, section 4.3).
+func (cm certManager) Discover(ctx context.Context, realm string) (_ *ProviderMetadata, err error) {
+	ctx, span := cm.tracer.Start(ctx, "cert.Discover", trace.WithAttributes(attrRealm.String(realm)))
+	defer func() { instrument.EndSpan(span, err) }()
+	if md, ok := cm.discoveries.lookup(realm); ok {
+		span.SetAttributes(attrCacheHit.Bool(true))
+		return md, nil
+	}
+	span.SetAttributes(attrCacheHit.Bool(false))
+	//Get configurations
+	urlConfiguration := cm.layout.DiscoveryURL(cm.basePath, realm)
+	conf, err := cm.fetch(ctx, realm, urlConfiguration, metrics.DocumentConfiguration)
+	if err != nil {
+		return nil, err
+	}
+	var md ProviderMetadata
+	if err = json.Unmarshal(conf.body, &md); err != nil {
+		return nil, err
+	}
+	if expected := cm.layout.Issuer(cm.basePath, realm); !cm.skipIssuerCheck && md.Issuer != expected {
+		return nil, fmt.Errorf("%w: got %q, want %q", ErrIssuerMismatch, md.Issuer, expected)
+	}
+	cm.discoveries.store(realm, &md)
+	return &md, nil
+}
@@ -0,0 +1,89 @@
+package cert
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+const keycloakDiscovery = `{
+	"issuer": "https://idm/realms/test",
+	"authorization_endpoint": "https://idm/realms/test/protocol/openid-connect/auth",
+	"token_endpoint": "https://idm/realms/test/protocol/openid-connect/token",
+	"jwks_uri": "https://idm/realms/test/protocol/openid-connect/certs",
+	"grant_types_supported": ["authorization_code", "client_credentials"],
+	"id_token_signing_alg_values_supported": ["RS256", "ES256"],
+	"scopes_supported": ["openid", "profile"],
+	"tls_client_certificate_bound_access_tokens": true,
+	"mtls_endpoint_aliases": {"token_endpoint": "https://mtls.idm/realms/test/protocol/openid-connect/token"}
+}`
+
+func Test_certManager_Discover(t *testing.T) {
+	want := &ProviderMetadata{
+		Issuer:                                "https://idm/realms/test",
+		AuthorizationEndpoint:                 "https://idm/realms/test/protocol/openid-connect/auth",
+		TokenEndpoint:                         "https://idm/realms/test/protocol/openid-connect/token",
+		JWKSURI:                               "https://idm/realms/test/protocol/openid-connect/certs",
+		GrantTypesSupported:                   []string{"authorization_code", "client_credentials"},
+		IDTokenSigningAlgValuesSupported:      []string{"RS256", "ES256"},
+		ScopesSupported:                       []string{"openid", "profile"},
+		TLSClientCertificateBoundAccessTokens: true,
+		MTLSEndpointAliases:                   map[string]string{"token_endpoint": "https://mtls.idm/realms/test/protocol/openid-connect/token"},
+	}
+	tests := []struct {
+		name     string
+		basePath string
+		opts     []Option
+		want     *ProviderMetadata
+		wantErr  error
+	}{
+		{
+			name:     "success",
+			basePath: "https://idm/realms",
+			want:     want,
+		},
+		{
+			name:     "issuer mismatch",
+			basePath: "http://keycloak:8080/realms",
+			wantErr:  ErrIssuerMismatch,
+		},
+		{
+			name:     "issuer mismatch allowed",
+			basePath: "http://keycloak:8080/realms",
+			opts:     []Option{WithoutIssuerCheck()},
+			want:     want,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			requests := 0
+			client := &HttpClientCustomMock{
+				DoMock: func(req *http.Request) (*http.Response, error) {
+					requests++
+					return &http.Response{
+						StatusCode: http.StatusOK,
+						Header:     jsonHeader,
+						Body:       ioutil.NopCloser(bytes.NewBufferString(keycloakDiscovery)),
+					}, nil
+				},
+			}
+			cm := NewCertManager(tt.basePath, client, tt.opts...).(Discoverer)
+			for i := 0; i < 2; i++ {
+				got, err := cm.Discover(context.Background(), "test")
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("Discover() error = %v, wantErr %v", err, tt.wantErr)
+				}
+				if !reflect.DeepEqual(got, tt.want) {
+					t.Fatalf("Discover() got = %+v, want %+v", got, tt.want)
+				}
+			}
+			if tt.wantErr == nil && requests != 1 {
+				t.Errorf("discovery requests = %d, want 1", requests)
+			}
+		})
+	}
+}
@@ -0,0 +1,120 @@
+package cert
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const cacheFileExt = ".json"
+
+// keySet is a realm's key set as fetched from the identity provider.
+type keySet struct {
+	Realm     string    `json:"realm"`
+	JWKSURI   string    `json:"jwks_uri"`
+	ETag      string    `json:"etag,omitempty"`
+	FetchedAt time.Time `json:"fetched_at"`
+	Keys      []Cert    `json:"keys"`
+}
+
+// diskCache keeps the last key set fetched for each realm on disk, one file
+// per realm, so a restarted process can still validate tokens while the
+// identity provider is unreachable.
+type diskCache struct {
+	dir      string
+	maxStale time.Duration
+	mu       sync.RWMutex
+	sets     map[string]*keySet
+}
+
+// WithDiskCache persists every fetched key set under dir and loads the ones
+// already there when the manager is created. When the identity provider
+// cannot be reached or fails with a 5xx, the last known good key set of the
+// realm is used as long as it is not older than maxStale; a zero maxStale
+// accepts key sets of any age. A document or key set that was rejected is
+// reported, never replaced by the cache. Use a dedicated directory per
+// manager, files are named after the realm.
+func WithDiskCache(dir string, maxStale time.Duration) Option {
+	return func(cm *certManager) {
+		dc := &diskCache{
+			dir:      dir,
+			maxStale: maxStale,
+			sets:     make(map[string]*keySet),
+		}
+		dc.load()
+		cm.diskCache = dc
+	}
+}
+
+func (dc *diskCache) load() {
+	files, err := ioutil.ReadDir(dc.dir)
+	if err != nil {
+		return
+	}
+	for _, f := range files {
+		if f.IsDir() || !strings.HasSuffix(f.Name(), cacheFileExt) {
+			continue
+		}
+		b, err := ioutil.ReadFile(filepath.Join(dc.dir, f.Name()))
+		if err != nil {
+			continue
+		}
+		var ks keySet
+		if err = json.Unmarshal(b, &ks); err != nil || len(ks.Realm) == 0 {
+			continue
+		}
+		dc.sets[ks.Realm] = &ks
+	}
+}
+
+func (dc *diskCache) latest(realm string) (*keySet, bool) {
+	dc.mu.RLock()
+	defer dc.mu.RUnlock()
+	ks, ok := dc.sets[realm]
+	return ks, ok
+}
+
+func (dc *diskCache) lastKnownGood(realm string) (*keySet, bool) {
+	ks, ok := dc.latest(realm)
+	if !ok {
+		return nil, false
+	}
+	if dc.maxStale > 0 && time.Since(ks.FetchedAt) > dc.maxStale {
+		return nil, false
+	}
+	return ks, true
+}
+
+// store writes the key set to a temporary file and renames it over the
+// realm's file, so a crash never leaves a truncated cache behind.
+func (dc *diskCache) store(ks *keySet) error {
+	dc.mu.Lock()
+	dc.sets[ks.Realm] = ks
+	dc.mu.Unlock()
+
+	b, err := json.Marshal(ks)
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(dc.dir, 0700); err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(dc.dir, ".jwks-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err = tmp.Write(b); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), filepath.Join(dc.dir, url.PathEscape(ks.Realm)+cacheFileExt))
+}
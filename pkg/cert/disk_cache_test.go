@@ -0,0 +1,129 @@
+package cert
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"testing"
+	"time"
+)
+
+func Test_certManager_DiskCache(t *testing.T) {
+	dir, err := ioutil.TempDir("", "jwks-cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	online := &HttpClientCustomMock{
+		DoMock: func(req *http.Request) (*http.Response, error) {
+			if req.URL.Path == "test/test/.well-known/openid-configuration" {
+				return &http.Response{
+					StatusCode: http.StatusOK,
+					Header:     jsonHeader,
+					Body:       ioutil.NopCloser(bytes.NewBufferString(respConfiguration)),
+				}, nil
+			}
+			return &http.Response{
+				StatusCode: http.StatusOK,
+				Header:     http.Header{"Content-Type": []string{"application/json"}, "Etag": []string{`"v1"`}},
+				Body:       ioutil.NopCloser(bytes.NewBufferString(respCerts)),
+			}, nil
+		},
+	}
+	offline := &HttpClientCustomMock{
+		DoMock: func(req *http.Request) (*http.Response, error) {
+			return nil, errors.New("connection refused")
+		},
+	}
+
+	warm := NewCertManager("test", online, append(testIdP, WithDiskCache(dir, time.Hour))...)
+	if _, err = warm.Cert(keycloakKid, "test"); err != nil {
+		t.Fatalf("Cert() error = %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		realm    string
+		maxStale time.Duration
+		wantErr  bool
+	}{
+		{name: "last known good", realm: "test", maxStale: time.Hour},
+		{name: "no staleness limit", realm: "test", maxStale: 0},
+		{name: "too stale", realm: "test", maxStale: time.Nanosecond, wantErr: true},
+		{name: "realm never fetched", realm: "other", maxStale: time.Hour, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			restarted := NewCertManager("test", offline, append(testIdP, WithDiskCache(dir, tt.maxStale))...)
+			got, err := restarted.Cert(keycloakKid, tt.realm)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Cert() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if err == nil && got.Kid != keycloakKid {
+				t.Errorf("Cert() got = %v, want %v", got.Kid, keycloakKid)
+			}
+		})
+	}
+
+	cached := NewCertManager("test", offline, WithDiskCache(dir, 0)).(certManager).diskCache
+	ks, _ := cached.lastKnownGood("test")
+	if ks.ETag != `"v1"` || ks.JWKSURI != "http://base/test/protocol/openid-connect/certs" {
+		t.Errorf("persisted key set = %+v", ks)
+	}
+}
+
+func Test_certManager_DiskCacheRejected(t *testing.T) {
+	dir, err := ioutil.TempDir("", "jwks-cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	idp := func(configuration string) *HttpClientCustomMock {
+		return &HttpClientCustomMock{
+			DoMock: func(req *http.Request) (*http.Response, error) {
+				body := respCerts
+				if req.URL.Path == "test/test/.well-known/openid-configuration" {
+					body = configuration
+				}
+				return &http.Response{
+					StatusCode: http.StatusOK,
+					Header:     jsonHeader,
+					Body:       ioutil.NopCloser(bytes.NewBufferString(body)),
+				}, nil
+			},
+		}
+	}
+
+	warm := NewCertManager("test", idp(respConfiguration), append(testIdP, WithDiskCache(dir, 0))...)
+	if _, err = warm.Cert(keycloakKid, "test"); err != nil {
+		t.Fatalf("Cert() error = %v", err)
+	}
+
+	tests := []struct {
+		name          string
+		configuration string
+		wantErr       error
+	}{
+		{
+			name:          "issuer mismatch",
+			configuration: `{"issuer":"https://evil.example/test","jwks_uri":"http://base/test/protocol/openid-connect/certs"}`,
+			wantErr:       ErrIssuerMismatch,
+		},
+		{
+			name:          "foreign jwks host",
+			configuration: `{"issuer":"test/test","jwks_uri":"http://evil.example/certs"}`,
+			wantErr:       ErrForeignJWKSHost,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			restarted := NewCertManager("test", idp(tt.configuration), append(testIdP, WithDiskCache(dir, 0))...)
+			if _, err := restarted.Cert(keycloakKid, "test"); !errors.Is(err, tt.wantErr) {
+				t.Errorf("Cert() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,194 @@
+package cert
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+)
+
+const (
+	defaultMaxResponseSize int64 = 1 << 20
+	defaultRequestTimeout        = 10 * time.Second
+	maxRedirects                 = 3
+)
+
+var (
+	ErrResponseTooLarge  = errors.New("response body exceeds the maximum size")
+	ErrInsecureJWKSURI   = errors.New("jwks_uri must use https")
+	ErrForeignJWKSHost   = errors.New("jwks_uri is not on the issuer host")
+	ErrInsecureRedirect  = errors.New("redirect from https to http")
+	ErrTooManyRedirects  = errors.New("too many redirects")
+	ErrUnexpectedContent = errors.New("unexpected content type")
+)
+
+// StatusError reports a non 2xx answer of the identity provider.
+type StatusError struct {
+	What       string
+	StatusCode int
+	URL        string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("error get %s. Response code: %d. Url: %s", e.What, e.StatusCode, e.URL)
+}
+
+// WithMaxResponseSize limits the size of discovery and JWKS responses, 1 MiB
+// by default.
+func WithMaxResponseSize(n int64) Option {
+	return func(cm *certManager) {
+		cm.maxResponseSize = n
+	}
+}
+
+// WithRequestTimeout bounds every request to the identity provider, 10
+// seconds by default.
+func WithRequestTimeout(d time.Duration) Option {
+	return func(cm *certManager) {
+		cm.requestTimeout = d
+	}
+}
+
+// WithInsecureHTTP accepts a jwks_uri over plain http. Meant for tests and
+// local identity providers only.
+func WithInsecureHTTP() Option {
+	return func(cm *certManager) {
+		cm.insecureHTTP = true
+	}
+}
+
+// WithAllowedJWKSHosts accepts a discovered jwks_uri on one of hosts besides
+// the issuer host, for providers serving keys from a CDN.
+func WithAllowedJWKSHosts(hosts ...string) Option {
+	return func(cm *certManager) {
+		for _, h := range hosts {
+			cm.allowedJWKSHosts[strings.ToLower(h)] = true
+		}
+	}
+}
+
+// NewHTTPClient returns an HttpClient suited to the manager: requests time
+// out, at most three redirects are followed and https is never downgraded.
+func NewHTTPClient() *http.Client {
+	return &http.Client{
+		Timeout:       defaultRequestTimeout,
+		CheckRedirect: checkRedirect,
+	}
+}
+
+func checkRedirect(req *http.Request, via []*http.Request) error {
+	if len(via) >= maxRedirects {
+		return ErrTooManyRedirects
+	}
+	if via[len(via)-1].URL.Scheme == "https" && req.URL.Scheme != "https" {
+		return ErrInsecureRedirect
+	}
+	return nil
+}
+
+// checkJWKSURI applies the https-only and same-host policies to a jwks_uri
+// read from a discovery document. The host is compared with the one of the
+// issuer the layout expects for the realm, never with the issuer the
+// document declares, which is unchecked under WithoutIssuerCheck.
+func (cm certManager) checkJWKSURI(realm, jwksURI string) error {
+	u, err := url.Parse(jwksURI)
+	if err != nil {
+		return err
+	}
+	if u.Scheme != "https" && !cm.insecureHTTP {
+		return fmt.Errorf("%w: %s", ErrInsecureJWKSURI, jwksURI)
+	}
+	issuer, err := url.Parse(cm.layout.Issuer(cm.basePath, realm))
+	if err != nil {
+		return err
+	}
+	host := strings.ToLower(u.Hostname())
+	if host != strings.ToLower(issuer.Hostname()) && !cm.allowedJWKSHosts[host] {
+		return fmt.Errorf("%w: %s", ErrForeignJWKSHost, jwksURI)
+	}
+	return nil
+}
+
+// get fetches rawURL, sending If-None-Match and If-Modified-Since when a
+// previous response is known. A 304 Not Modified answers with that previous
+// response; what names the document in error messages. The status code is 0
+// when no response was received.
+func (cm certManager) get(ctx context.Context, rawURL, what string) (*cachedResponse, int, error) {
+	if cm.requestTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, cm.requestTimeout)
+		defer cancel()
+	}
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	req.Header.Set("Accept", "application/json")
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(req.Header))
+	prev := cm.responses.lookup(rawURL)
+	if prev != nil {
+		if len(prev.etag) > 0 {
+			req.Header.Set("If-None-Match", prev.etag)
+		}
+		if len(prev.lastModified) > 0 {
+			req.Header.Set("If-Modified-Since", prev.lastModified)
+		}
+	}
+	resp, err := cm.httpClient.Do(req)
+	if err != nil {
+		if errors.Is(err, ErrInsecureRedirect) || errors.Is(err, ErrTooManyRedirects) {
+			return nil, 0, err
+		}
+		return nil, 0, &unreachableError{err: err}
+	}
+	if resp.Body != nil {
+		defer resp.Body.Close()
+	}
+	if resp.Request != nil && resp.Request.URL.Scheme != req.URL.Scheme && req.URL.Scheme == "https" {
+		return nil, resp.StatusCode, ErrInsecureRedirect
+	}
+	if resp.StatusCode == http.StatusNotModified && prev != nil {
+		return prev, resp.StatusCode, nil
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, resp.StatusCode, &StatusError{What: what, StatusCode: resp.StatusCode, URL: rawURL}
+	}
+	if err = checkContentType(resp.Header.Get("Content-Type")); err != nil {
+		return nil, resp.StatusCode, err
+	}
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, cm.maxResponseSize+1))
+	if err != nil {
+		return nil, resp.StatusCode, err
+	}
+	if int64(len(body)) > cm.maxResponseSize {
+		return nil, resp.StatusCode, fmt.Errorf("%w: %s", ErrResponseTooLarge, rawURL)
+	}
+	entry := &cachedResponse{
+		etag:         resp.Header.Get("ETag"),
+		lastModified: resp.Header.Get("Last-Modified"),
+		body:         body,
+	}
+	if len(entry.etag) > 0 || len(entry.lastModified) > 0 {
+		cm.responses.store(rawURL, entry)
+	}
+	return entry, resp.StatusCode, nil
+}
+
+// checkContentType accepts application/json and the +json media types, such
+// as application/jwk-set+json.
+func checkContentType(contentType string) error {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return fmt.Errorf("%w: %q", ErrUnexpectedContent, contentType)
+	}
+	if mediaType != "application/json" && !(strings.HasPrefix(mediaType, "application/") && strings.HasSuffix(mediaType, "+json")) {
+		return fmt.Errorf("%w: %q", ErrUnexpectedContent, contentType)
+	}
+	return nil
+}
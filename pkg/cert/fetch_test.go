@@ -0,0 +1,149 @@
+package cert
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_certManager_HardenedFetch(t *testing.T) {
+	discoveryOf := func(issuer, jwksURI string) string {
+		return `{"issuer":"` + issuer + `","jwks_uri":"` + jwksURI + `"}`
+	}
+	discovery := func(jwksURI string) string {
+		return discoveryOf("https://idm/realms/test", jwksURI)
+	}
+	idp := func(conf, contentType, keys string) HttpClient {
+		return &HttpClientCustomMock{
+			DoMock: func(req *http.Request) (*http.Response, error) {
+				body := keys
+				if strings.HasSuffix(req.URL.Path, "/.well-known/openid-configuration") {
+					body = conf
+				}
+				return &http.Response{
+					StatusCode: http.StatusOK,
+					Header:     http.Header{"Content-Type": []string{contentType}},
+					Body:       ioutil.NopCloser(bytes.NewBufferString(body)),
+				}, nil
+			},
+		}
+	}
+	tests := []struct {
+		name    string
+		client  HttpClient
+		opts    []Option
+		wantErr error
+	}{
+		{
+			name:   "success",
+			client: idp(discovery("https://idm/realms/test/certs"), "application/json; charset=utf-8", respCerts),
+		},
+		{
+			name:   "jwk-set content type",
+			client: idp(discovery("https://idm/realms/test/certs"), "application/jwk-set+json", respCerts),
+		},
+		{
+			name:    "html content type",
+			client:  idp(discovery("https://idm/realms/test/certs"), "text/html", respCerts),
+			wantErr: ErrUnexpectedContent,
+		},
+		{
+			name:    "response too large",
+			client:  idp(discovery("https://idm/realms/test/certs"), "application/json", respCerts),
+			opts:    []Option{WithMaxResponseSize(128)},
+			wantErr: ErrResponseTooLarge,
+		},
+		{
+			name:    "http jwks_uri",
+			client:  idp(discovery("http://idm/realms/test/certs"), "application/json", respCerts),
+			wantErr: ErrInsecureJWKSURI,
+		},
+		{
+			name:   "http jwks_uri allowed",
+			client: idp(discovery("http://idm/realms/test/certs"), "application/json", respCerts),
+			opts:   []Option{WithInsecureHTTP()},
+		},
+		{
+			name:    "jwks_uri on another host",
+			client:  idp(discovery("https://evil/certs"), "application/json", respCerts),
+			wantErr: ErrForeignJWKSHost,
+		},
+		{
+			name:    "jwks_uri on the host of an unchecked issuer",
+			client:  idp(discoveryOf("https://public.idm/realms/test", "https://public.idm/realms/test/certs"), "application/json", respCerts),
+			opts:    []Option{WithoutIssuerCheck()},
+			wantErr: ErrForeignJWKSHost,
+		},
+		{
+			name:   "jwks_uri on an allowed host of an unchecked issuer",
+			client: idp(discoveryOf("https://public.idm/realms/test", "https://public.idm/realms/test/certs"), "application/json", respCerts),
+			opts:   []Option{WithoutIssuerCheck(), WithAllowedJWKSHosts("public.idm")},
+		},
+		{
+			name:   "jwks_uri on the layout host of an unchecked issuer",
+			client: idp(discoveryOf("https://public.idm/realms/test", "https://idm/realms/test/certs"), "application/json", respCerts),
+			opts:   []Option{WithoutIssuerCheck()},
+		},
+		{
+			name:    "spoofed issuer and jwks_uri",
+			client:  idp(discoveryOf("https://evil/realms/test", "https://evil/certs"), "application/json", respCerts),
+			opts:    []Option{WithoutIssuerCheck()},
+			wantErr: ErrForeignJWKSHost,
+		},
+		{
+			name:   "jwks_uri on an allowed host",
+			client: idp(discovery("https://cdn.idm/certs"), "application/json", respCerts),
+			opts:   []Option{WithAllowedJWKSHosts("CDN.idm")},
+		},
+		{
+			name:    "configured http jwks_uri",
+			client:  idp("", "application/json", respCerts),
+			opts:    []Option{WithJWKSURI("http://idm/certs")},
+			wantErr: ErrInsecureJWKSURI,
+		},
+		{
+			name: "request timeout",
+			client: &HttpClientCustomMock{
+				DoMock: func(req *http.Request) (*http.Response, error) {
+					<-req.Context().Done()
+					return nil, req.Context().Err()
+				},
+			},
+			opts:    []Option{WithRequestTimeout(10 * time.Millisecond)},
+			wantErr: context.DeadlineExceeded,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cm := NewCertManager("https://idm/realms", tt.client, tt.opts...)
+			_, err := cm.Cert(keycloakKid, "test")
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("Cert() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func Test_NewHTTPClient_Redirects(t *testing.T) {
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, srv.URL+r.URL.Path+"x", http.StatusFound)
+	}))
+	defer srv.Close()
+	_, err := NewHTTPClient().Get(srv.URL + "/")
+	if !errors.Is(err, ErrTooManyRedirects) {
+		t.Errorf("Get() error = %v, wantErr %v", err, ErrTooManyRedirects)
+	}
+
+	from, _ := http.NewRequest(http.MethodGet, "https://idm/certs", nil)
+	to, _ := http.NewRequest(http.MethodGet, "http://idm/certs", nil)
+	if err = checkRedirect(to, []*http.Request{from}); !errors.Is(err, ErrInsecureRedirect) {
+		t.Errorf("checkRedirect() error = %v, wantErr %v", err, ErrInsecureRedirect)
+	}
+}
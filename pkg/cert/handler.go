@@ -0,0 +1,240 @@
+package cert
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultHandlerMaxAge = 5 * time.Minute
+	// handlerRefreshTimeout bounds a refresh from the manager, which does
+	// not end with the request that started it.
+	handlerRefreshTimeout = 30 * time.Second
+)
+
+// publishedKey is Cert with every empty member left out, the way identity
+// providers publish their keys.
+type publishedKey struct {
+	Kty     string   `json:"kty"`
+	Use     string   `json:"use,omitempty"`
+	Alg     string   `json:"alg,omitempty"`
+	Kid     string   `json:"kid,omitempty"`
+	X5t     string   `json:"x5t,omitempty"`
+	N       string   `json:"n,omitempty"`
+	E       string   `json:"e,omitempty"`
+	X5c     []string `json:"x5c,omitempty"`
+	X5tS256 string   `json:"x5t#S256,omitempty"`
+	Crv     string   `json:"crv,omitempty"`
+	X       string   `json:"x,omitempty"`
+	Y       string   `json:"y,omitempty"`
+}
+
+// document is a response body of the handler with its entity tag.
+type document struct {
+	body      []byte
+	etag      string
+	fetchedAt time.Time
+}
+
+// slot holds a document of the handler and its refresh in flight, if any.
+type slot struct {
+	doc     *document
+	refresh *refresh
+}
+
+// refresh is a document load shared by the requests waiting for it. doc and
+// err are set before done is closed.
+type refresh struct {
+	done chan struct{}
+	doc  *document
+	err  error
+}
+
+type jwksHandler struct {
+	manager Manager
+	realm   string
+	maxAge  time.Duration
+	jwksURI string
+
+	mu        sync.Mutex
+	jwks      slot
+	discovery slot
+}
+
+// HandlerOption customizes the handler built by NewJWKSHandler.
+type HandlerOption func(*jwksHandler)
+
+// WithHandlerMaxAge sets the Cache-Control max-age of the responses, which is
+// also how long the handler reuses a document before asking the manager
+// again. The default is five minutes.
+func WithHandlerMaxAge(d time.Duration) HandlerOption {
+	return func(h *jwksHandler) {
+		h.maxAge = d
+	}
+}
+
+// WithHandlerDiscovery also serves the provider metadata of the realm, on
+// requests whose path ends in /.well-known/openid-configuration, with its
+// jwks_uri replaced by jwksURI, the URL the handler is reachable at. The
+// manager must implement Discoverer.
+func WithHandlerDiscovery(jwksURI string) HandlerOption {
+	return func(h *jwksHandler) {
+		h.jwksURI = jwksURI
+	}
+}
+
+// NewJWKSHandler re-serves the key set the manager holds for realm, for
+// services that cannot reach the identity provider themselves. Documents are
+// refreshed from the manager in the background once they are older than
+// their max-age, one refresh at a time, and the last one is served while the
+// manager fails or is slow. m must implement KeySetManager.
+func NewJWKSHandler(m Manager, realm string, opts ...HandlerOption) http.Handler {
+	h := &jwksHandler{
+		manager: m,
+		realm:   realm,
+		maxAge:  defaultHandlerMaxAge,
+	}
+	for _, opt := range opts {
+		opt(h)
+	}
+	return h
+}
+
+func (h *jwksHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	contentType := "application/jwk-set+json"
+	s, load := &h.jwks, h.loadKeySet
+	if strings.HasSuffix(req.URL.Path, openIDConfigurationPath) {
+		if len(h.jwksURI) == 0 {
+			http.NotFound(w, req)
+			return
+		}
+		contentType = "application/json"
+		s, load = &h.discovery, h.loadDiscovery
+	}
+	doc, err := h.document(req.Context(), s, load)
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusBadGateway), http.StatusBadGateway)
+		return
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", int(h.maxAge/time.Second)))
+	w.Header().Set("ETag", doc.etag)
+	if etagMatches(req.Header.Get("If-None-Match"), doc.etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	_, _ = w.Write(doc.body)
+}
+
+// document returns the document of s. Once it is older than maxAge, load
+// refreshes it in the background, one refresh shared by every request and
+// outliving ctx, and the previous document keeps being served meanwhile. Only
+// the requests that come before any document wait for the refresh.
+func (h *jwksHandler) document(ctx context.Context, s *slot, load func(context.Context) (*document, error)) (*document, error) {
+	h.mu.Lock()
+	cached := s.doc
+	if cached != nil && time.Since(cached.fetchedAt) < h.maxAge {
+		h.mu.Unlock()
+		return cached, nil
+	}
+	r := s.refresh
+	if r == nil {
+		r = &refresh{done: make(chan struct{})}
+		s.refresh = r
+		go h.refresh(context.WithoutCancel(ctx), s, r, load)
+	}
+	h.mu.Unlock()
+	if cached != nil {
+		return cached, nil
+	}
+
+	select {
+	case <-r.done:
+		return r.doc, r.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (h *jwksHandler) refresh(ctx context.Context, s *slot, r *refresh, load func(context.Context) (*document, error)) {
+	ctx, cancel := context.WithTimeout(ctx, handlerRefreshTimeout)
+	defer cancel()
+	r.doc, r.err = load(ctx)
+	h.mu.Lock()
+	if r.err == nil {
+		s.doc = r.doc
+	}
+	s.refresh = nil
+	h.mu.Unlock()
+	close(r.done)
+}
+
+func (h *jwksHandler) loadKeySet(ctx context.Context) (*document, error) {
+	ksm, ok := h.manager.(KeySetManager)
+	if !ok {
+		return nil, errors.New("the manager does not list key sets")
+	}
+	keys, err := ksm.KeySet(ctx, h.realm)
+	if err != nil {
+		return nil, err
+	}
+	published := make([]publishedKey, len(keys))
+	for i, k := range keys {
+		published[i] = publishedKey(k)
+	}
+	return newDocument(struct {
+		Keys []publishedKey `json:"keys"`
+	}{Keys: published})
+}
+
+func (h *jwksHandler) loadDiscovery(ctx context.Context) (*document, error) {
+	d, ok := h.manager.(Discoverer)
+	if !ok {
+		return nil, errors.New("the manager does not read provider metadata")
+	}
+	md, err := d.Discover(ctx, h.realm)
+	if err != nil {
+		return nil, err
+	}
+	rewritten := *md
+	rewritten.JWKSURI = h.jwksURI
+	return newDocument(rewritten)
+}
+
+func newDocument(v interface{}) (*document, error) {
+	body, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(body)
+	return &document{
+		body:      body,
+		etag:      `"` + base64.RawURLEncoding.EncodeToString(sum[:]) + `"`,
+		fetchedAt: time.Now(),
+	}, nil
+}
+
+// etagMatches implements the weak comparison of If-None-Match (RFC 9110,
+// section 13.1.2).
+func etagMatches(ifNoneMatch, etag string) bool {
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,252 @@
+package cert
+
+import (
+	"context"
+	"crypto/elliptic"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func Test_jwksHandler(t *testing.T) {
+	rsaKey, ecKey := *rsaJWK(t, 2048), *ecJWK(t, elliptic.P256())
+	calls := 0
+	manager := ManagerCustomMock{
+		KeySetMock: func(ctx context.Context, realm string) ([]Cert, error) {
+			calls++
+			return []Cert{rsaKey, ecKey}, nil
+		},
+	}
+	h := NewJWKSHandler(manager, "test")
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/realms/test/protocol/openid-connect/certs", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", rec.Code)
+	}
+	for header, want := range map[string]string{
+		"Content-Type":  "application/jwk-set+json",
+		"Cache-Control": "public, max-age=300",
+	} {
+		if got := rec.Header().Get(header); got != want {
+			t.Errorf("%s = %q, want %q", header, got, want)
+		}
+	}
+	keys, err := decodeKeySet(rec.Body)
+	if err != nil {
+		t.Fatalf("decodeKeySet() error = %v", err)
+	}
+	if !reflect.DeepEqual(keys, []Cert{rsaKey, ecKey}) {
+		t.Errorf("keys = %+v", keys)
+	}
+	etag := rec.Header().Get("ETag")
+	if len(etag) == 0 {
+		t.Fatal("no ETag")
+	}
+
+	tests := []struct {
+		name        string
+		method      string
+		path        string
+		ifNoneMatch string
+		wantStatus  int
+	}{
+		{name: "revalidation", method: http.MethodGet, path: "/certs", ifNoneMatch: etag, wantStatus: http.StatusNotModified},
+		{name: "weak revalidation", method: http.MethodGet, path: "/certs", ifNoneMatch: `"other", W/` + etag, wantStatus: http.StatusNotModified},
+		{name: "changed", method: http.MethodGet, path: "/certs", ifNoneMatch: `"other"`, wantStatus: http.StatusOK},
+		{name: "head", method: http.MethodHead, path: "/certs", wantStatus: http.StatusOK},
+		{name: "post", method: http.MethodPost, path: "/certs", wantStatus: http.StatusMethodNotAllowed},
+		{name: "discovery not served", method: http.MethodGet, path: "/realms/test/.well-known/openid-configuration", wantStatus: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, nil)
+			if len(tt.ifNoneMatch) > 0 {
+				req.Header.Set("If-None-Match", tt.ifNoneMatch)
+			}
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+		})
+	}
+	if calls != 1 {
+		t.Errorf("KeySet() called %d times within max-age, want 1", calls)
+	}
+}
+
+func Test_jwksHandler_PublishedKeys(t *testing.T) {
+	h := NewJWKSHandler(NewStaticManager([]Cert{*ecJWK(t, elliptic.P384())}), "")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/certs", nil))
+	var jwks struct {
+		Keys []map[string]interface{} `json:"keys"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &jwks); err != nil {
+		t.Fatal(err)
+	}
+	if len(jwks.Keys) != 1 {
+		t.Fatalf("keys = %v", jwks.Keys)
+	}
+	for _, member := range []string{"n", "e", "x5c", "x5t", "x5t#S256", "use"} {
+		if v, ok := jwks.Keys[0][member]; ok {
+			t.Errorf("EC key published with %q: %v", member, v)
+		}
+	}
+}
+
+func Test_jwksHandler_ManagerFailure(t *testing.T) {
+	var failure error = errors.New("identity provider unreachable")
+	manager := ManagerCustomMock{
+		KeySetMock: func(ctx context.Context, realm string) ([]Cert, error) {
+			if failure != nil {
+				return nil, failure
+			}
+			return []Cert{*rsaJWK(t, 2048)}, nil
+		},
+	}
+	h := NewJWKSHandler(manager, "test", WithHandlerMaxAge(0))
+	get := func() *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/certs", nil))
+		return rec
+	}
+
+	if rec := get(); rec.Code != http.StatusBadGateway || strings.Contains(rec.Body.String(), failure.Error()) {
+		t.Errorf("without keys: status = %d, body = %q", rec.Code, rec.Body.String())
+	}
+	failure = nil
+	served := get()
+	failure = errors.New("identity provider unreachable")
+	if rec := get(); rec.Code != http.StatusOK || rec.Body.String() != served.Body.String() {
+		t.Errorf("with stale keys: status = %d, body = %q", rec.Code, rec.Body.String())
+	}
+	if got := served.Header().Get("Cache-Control"); got != "public, max-age=0" {
+		t.Errorf("Cache-Control = %q", got)
+	}
+}
+
+func Test_jwksHandler_Discovery(t *testing.T) {
+	idp := &flakyIdP{}
+	cm := NewCertManager("test", idp.client(), testIdP...)
+	h := NewJWKSHandler(cm, "test", WithHandlerDiscovery("https://gateway/realms/test/certs"), WithHandlerMaxAge(time.Minute))
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/realms/test/.well-known/openid-configuration", nil))
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "application/json" {
+		t.Fatalf("status = %d, Content-Type = %q", rec.Code, rec.Header().Get("Content-Type"))
+	}
+	var md ProviderMetadata
+	if err := json.Unmarshal(rec.Body.Bytes(), &md); err != nil {
+		t.Fatal(err)
+	}
+	if md.Issuer != "test/test" || md.JWKSURI != "https://gateway/realms/test/certs" {
+		t.Errorf("issuer = %q, jwks_uri = %q", md.Issuer, md.JWKSURI)
+	}
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/realms/test/certs", nil))
+	if keys, err := decodeKeySet(rec.Body); err != nil || len(keys) != 1 || keys[0].Kid != keycloakKid {
+		t.Errorf("keys = %v, %v", keys, err)
+	}
+}
+
+func Test_jwksHandler_SharedRefresh(t *testing.T) {
+	key := *rsaJWK(t, 2048)
+	release := make(chan struct{})
+	var calls int32
+	manager := ManagerCustomMock{
+		KeySetMock: func(ctx context.Context, realm string) ([]Cert, error) {
+			atomic.AddInt32(&calls, 1)
+			<-release
+			return []Cert{key}, ctx.Err()
+		},
+	}
+	h := NewJWKSHandler(manager, "test")
+
+	// The client that starts the refresh goes away before it completes.
+	ctx, cancel := context.WithCancel(context.Background())
+	gone := httptest.NewRecorder()
+	left := make(chan struct{})
+	go func() {
+		h.ServeHTTP(gone, httptest.NewRequest(http.MethodGet, "/certs", nil).WithContext(ctx))
+		close(left)
+	}()
+	for atomic.LoadInt32(&calls) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+	<-left
+
+	var wg sync.WaitGroup
+	recs := make([]*httptest.ResponseRecorder, 4)
+	for i := range recs {
+		recs[i] = httptest.NewRecorder()
+		wg.Add(1)
+		go func(rec *httptest.ResponseRecorder) {
+			defer wg.Done()
+			h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/certs", nil))
+		}(recs[i])
+	}
+	close(release)
+	wg.Wait()
+	for i, rec := range recs {
+		if rec.Code != http.StatusOK {
+			t.Errorf("request %d: status = %d, want 200", i, rec.Code)
+		}
+	}
+	if n := atomic.LoadInt32(&calls); n != 1 {
+		t.Errorf("KeySet() called %d times, want 1", n)
+	}
+}
+
+func Test_jwksHandler_StaleWhileRefreshing(t *testing.T) {
+	key := *rsaJWK(t, 2048)
+	release := make(chan struct{})
+	defer close(release)
+	var calls int32
+	manager := ManagerCustomMock{
+		KeySetMock: func(ctx context.Context, realm string) ([]Cert, error) {
+			if atomic.AddInt32(&calls, 1) > 1 {
+				<-release
+			}
+			return []Cert{key}, nil
+		},
+	}
+	h := NewJWKSHandler(manager, "test", WithHandlerMaxAge(0))
+	first := httptest.NewRecorder()
+	h.ServeHTTP(first, httptest.NewRequest(http.MethodGet, "/certs", nil))
+
+	// The manager blocks every refresh from now on.
+	for i := 0; i < 3; i++ {
+		served := make(chan *httptest.ResponseRecorder)
+		go func() {
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/certs", nil))
+			served <- rec
+		}()
+		select {
+		case rec := <-served:
+			if rec.Code != http.StatusOK || rec.Body.String() != first.Body.String() {
+				t.Errorf("request %d: status = %d, body = %q, want the stale keys", i, rec.Code, rec.Body.String())
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("request %d waited for the refresh", i)
+		}
+	}
+	// One refresh is in flight for all of them.
+	for atomic.LoadInt32(&calls) < 2 {
+		time.Sleep(time.Millisecond)
+	}
+	if n := atomic.LoadInt32(&calls); n != 2 {
+		t.Errorf("KeySet() called %d times, want 2", n)
+	}
+}
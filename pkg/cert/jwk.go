@@ -0,0 +1,120 @@
+package cert
+
+import (
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+)
+
+const (
+	// minRSAModulusBits rejects moduli too small to be anything but a
+	// mistake. WithKeyPolicy sets the minimum actually accepted.
+	minRSAModulusBits = 512
+	maxRSAModulusBits = 16384
+	maxRSAExponent    = 1<<31 - 1
+	maxKeySetSize     = 100
+)
+
+var (
+	ErrInvalidJWK  = errors.New("invalid JWK")
+	ErrInvalidJWKS = errors.New("invalid JWKS")
+)
+
+// base64urlUInt decodes a Base64urlUInt member (RFC 7518, section 2): the
+// unpadded base64url encoding of the minimal big-endian octets of a value.
+func base64urlUInt(name, s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.Strict().DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %q is not base64url: %v", ErrInvalidJWK, name, err)
+	}
+	if len(b) == 0 {
+		return nil, fmt.Errorf("%w: %q is empty", ErrInvalidJWK, name)
+	}
+	if len(b) > 1 && b[0] == 0 {
+		return nil, fmt.Errorf("%w: %q has leading zero octets", ErrInvalidJWK, name)
+	}
+	return new(big.Int).SetBytes(b), nil
+}
+
+func rsaPublicKey(cert *Cert) (*rsa.PublicKey, error) {
+	n, err := base64urlUInt("n", cert.N)
+	if err != nil {
+		return nil, err
+	}
+	e, err := base64urlUInt("e", cert.E)
+	if err != nil {
+		return nil, err
+	}
+	if bits := n.BitLen(); bits < minRSAModulusBits || bits > maxRSAModulusBits {
+		return nil, fmt.Errorf("%w: %d bit RSA modulus", ErrInvalidJWK, bits)
+	}
+	if n.Bit(0) == 0 {
+		return nil, fmt.Errorf("%w: even RSA modulus", ErrInvalidJWK)
+	}
+	if !e.IsInt64() || e.Int64() < 3 || e.Int64() > maxRSAExponent || e.Bit(0) == 0 {
+		return nil, fmt.Errorf("%w: RSA exponent %s", ErrInvalidJWK, e)
+	}
+	return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+}
+
+// curves maps the "crv" values of EC keys to their curves.
+var curves = map[string]struct {
+	curve elliptic.Curve
+	ecdh  ecdh.Curve
+}{
+	"P-256": {elliptic.P256(), ecdh.P256()},
+	"P-384": {elliptic.P384(), ecdh.P384()},
+	"P-521": {elliptic.P521(), ecdh.P521()},
+}
+
+// ecPublicKey builds the key of an EC JWK. The coordinates must be as long as
+// the field size (RFC 7518, section 6.2.1) and the point must lie on the curve.
+func ecPublicKey(cert *Cert) (*ecdsa.PublicKey, error) {
+	c, ok := curves[cert.Crv]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnsupportedKeyType, cert.Crv)
+	}
+	size := (c.curve.Params().BitSize + 7) / 8
+	point := []byte{4}
+	for _, m := range []struct{ name, value string }{{"x", cert.X}, {"y", cert.Y}} {
+		b, err := base64.RawURLEncoding.Strict().DecodeString(m.value)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %q is not base64url: %v", ErrInvalidJWK, m.name, err)
+		}
+		if len(b) != size {
+			return nil, fmt.Errorf("%w: %q is %d octets, %s needs %d", ErrInvalidJWK, m.name, len(b), cert.Crv, size)
+		}
+		point = append(point, b...)
+	}
+	if _, err := c.ecdh.NewPublicKey(point); err != nil {
+		return nil, fmt.Errorf("%w: point is not on %s", ErrInvalidJWK, cert.Crv)
+	}
+	return &ecdsa.PublicKey{
+		Curve: c.curve,
+		X:     new(big.Int).SetBytes(point[1 : 1+size]),
+		Y:     new(big.Int).SetBytes(point[1+size:]),
+	}, nil
+}
+
+func decodeKeySet(r io.Reader) ([]Cert, error) {
+	var kr struct {
+		Keys *[]Cert `json:"keys"`
+	}
+	if err := json.NewDecoder(r).Decode(&kr); err != nil {
+		return nil, err
+	}
+	if kr.Keys == nil {
+		return nil, fmt.Errorf("%w: no \"keys\" member", ErrInvalidJWKS)
+	}
+	if len(*kr.Keys) > maxKeySetSize {
+		return nil, fmt.Errorf("%w: %d keys, at most %d are accepted", ErrInvalidJWKS, len(*kr.Keys), maxKeySetSize)
+	}
+	return *kr.Keys, nil
+}
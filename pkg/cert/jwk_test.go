@@ -0,0 +1,164 @@
+package cert
+
+import (
+	"bytes"
+	"crypto/elliptic"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"strings"
+	"testing"
+)
+
+func Test_rsaPublicKey_Strict(t *testing.T) {
+	_, pub, _ := generateKeys()
+	n := base64.RawURLEncoding.EncodeToString(pub.N.Bytes())
+	e := base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes())
+	b64 := func(b ...byte) string { return base64.RawURLEncoding.EncodeToString(b) }
+	tests := []struct {
+		name    string
+		n, e    string
+		wantErr bool
+	}{
+		{name: "valid", n: n, e: e},
+		{name: "empty modulus", n: "", e: e, wantErr: true},
+		{name: "modulus with leading zero", n: b64(append([]byte{0}, pub.N.Bytes()...)...), e: e, wantErr: true},
+		{name: "padded modulus", n: base64.URLEncoding.EncodeToString(pub.N.Bytes()), e: e, wantErr: true},
+		{name: "non canonical base64", n: n, e: "AQAC", wantErr: true},
+		{name: "short modulus", n: b64(0xc5, 0x01), e: e, wantErr: true},
+		{name: "even modulus", n: base64.RawURLEncoding.EncodeToString(new(big.Int).Lsh(pub.N, 1).Bytes()), e: e, wantErr: true},
+		{name: "exponent of 1", n: n, e: b64(1), wantErr: true},
+		{name: "even exponent", n: n, e: b64(1, 0, 0), wantErr: true},
+		{name: "exponent with leading zero", n: n, e: b64(0, 1, 0, 1), wantErr: true},
+		{name: "exponent overflowing int", n: n, e: b64(0x80, 0, 0, 0, 0, 0, 0, 1), wantErr: true},
+		{name: "exponent longer than 8 bytes", n: n, e: b64(1, 0, 0, 0, 0, 0, 0, 0, 0, 1), wantErr: true},
+		{name: "largest exponent", n: n, e: b64(0x7f, 0xff, 0xff, 0xff)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := rsaPublicKey(&Cert{Kty: "RSA", N: tt.n, E: tt.e})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("rsaPublicKey() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil && !errors.Is(err, ErrInvalidJWK) {
+				t.Errorf("rsaPublicKey() error = %v, want %v", err, ErrInvalidJWK)
+			}
+			if err == nil && got.N.Cmp(pub.N) != 0 {
+				t.Errorf("rsaPublicKey() N = %v, want %v", got.N, pub.N)
+			}
+		})
+	}
+}
+
+func Test_decodeKeySet_Strict(t *testing.T) {
+	tests := []struct {
+		name    string
+		jwks    string
+		want    int
+		wantErr error
+	}{
+		{name: "empty set", jwks: `{"keys":[]}`},
+		{name: "keys", jwks: respCerts, want: 1},
+		{name: "no keys member", jwks: `{}`, wantErr: ErrInvalidJWKS},
+		{name: "null keys", jwks: `{"keys":null}`, wantErr: ErrInvalidJWKS},
+		{name: "too many keys", jwks: `{"keys":[` + strings.Repeat(`{"kty":"RSA"},`, maxKeySetSize) + `{"kty":"RSA"}]}`, wantErr: ErrInvalidJWKS},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := decodeKeySet(strings.NewReader(tt.jwks))
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("decodeKeySet() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if len(got) != tt.want {
+				t.Errorf("decodeKeySet() = %d keys, want %d", len(got), tt.want)
+			}
+		})
+	}
+}
+
+func Test_ecPublicKey(t *testing.T) {
+	valid := ecJWK(t, elliptic.P256())
+	short := *valid
+	short.X = base64.RawURLEncoding.EncodeToString(make([]byte, 31))
+	offCurve := *valid
+	offCurve.Y = valid.X
+	unknown := *valid
+	unknown.Crv = "secp256k1"
+	tests := []struct {
+		name    string
+		cert    *Cert
+		wantErr error
+	}{
+		{name: "valid", cert: valid},
+		{name: "short coordinate", cert: &short, wantErr: ErrInvalidJWK},
+		{name: "point not on the curve", cert: &offCurve, wantErr: ErrInvalidJWK},
+		{name: "unknown curve", cert: &unknown, wantErr: ErrUnsupportedKeyType},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key, err := ecPublicKey(tt.cert)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("ecPublicKey() error = %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && key.Curve != elliptic.P256() {
+				t.Errorf("ecPublicKey() curve = %v", key.Curve.Params().Name)
+			}
+		})
+	}
+}
+
+func FuzzPublicKey(f *testing.F) {
+	var kr struct {
+		Keys []Cert `json:"keys"`
+	}
+	_ = json.Unmarshal([]byte(respCerts), &kr)
+	f.Add(kr.Keys[0].N, kr.Keys[0].E)
+	f.Add("", "AQAB")
+	f.Add(kr.Keys[0].N, "AQ")
+	f.Add(kr.Keys[0].N, "AAAAAAABAAE")
+	f.Add("AA"+kr.Keys[0].N, "AQAB")
+	f.Fuzz(func(t *testing.T, n, e string) {
+		pub, err := rsaPublicKey(&Cert{Kty: "RSA", N: n, E: e})
+		if err != nil {
+			if !errors.Is(err, ErrInvalidJWK) {
+				t.Fatalf("rsaPublicKey() error = %v, want %v", err, ErrInvalidJWK)
+			}
+			return
+		}
+		if bits := pub.N.BitLen(); bits < minRSAModulusBits || bits > maxRSAModulusBits || pub.N.Bit(0) == 0 {
+			t.Fatalf("accepted modulus of %d bits", bits)
+		}
+		if pub.E < 3 || pub.E > maxRSAExponent || pub.E%2 == 0 {
+			t.Fatalf("accepted exponent %d", pub.E)
+		}
+		// Only the canonical encoding of a key is accepted.
+		if base64.RawURLEncoding.EncodeToString(pub.N.Bytes()) != n ||
+			base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()) != e {
+			t.Fatalf("accepted non canonical n %q or e %q", n, e)
+		}
+	})
+}
+
+func FuzzDecodeKeySet(f *testing.F) {
+	f.Add([]byte(`{"keys":[{"kid":"a","kty":"RSA","n":"wT2CKbhfhnRe7DqoJgRwn2Pu_6Sjk1CvmzvD9pYsb1s","e":"AQAB"}]}`))
+	f.Add([]byte(`{"keys":[]}`))
+	f.Add([]byte(`{"keys":[{"kty":"EC","crv":"P-256","x":"","y":""}]}`))
+	f.Add([]byte(`{"keys":null}`))
+	f.Add([]byte(`[]`))
+	f.Fuzz(func(t *testing.T, jwks []byte) {
+		keys, err := decodeKeySet(bytes.NewReader(jwks))
+		if err != nil {
+			return
+		}
+		if len(keys) > maxKeySetSize {
+			t.Fatalf("accepted %d keys", len(keys))
+		}
+		for _, k := range keys {
+			// Whatever the set holds, building a key must fail cleanly.
+			_, _ = rsaPublicKey(&k)
+			_, _ = k.Thumbprint()
+			_, _ = findCert(keys, k.Kid)
+		}
+	})
+}
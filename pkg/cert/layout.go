@@ -0,0 +1,89 @@
+package cert
+
+import (
+	"net/url"
+	"strings"
+)
+
+const (
+	openIDConfigurationPath = "/.well-known/openid-configuration"
+	oauthServerMetadataPath = "/.well-known/oauth-authorization-server"
+)
+
+// Layout tells where an identity provider publishes the issuer of a realm
+// and its metadata document.
+type Layout interface {
+	Issuer(basePath, realm string) string
+	DiscoveryURL(basePath, realm string) string
+}
+
+var (
+	// KeycloakLayout is the default: the issuer is {basePath}/{realm}, with a
+	// base path such as https://host/realms or https://host/auth/realms.
+	KeycloakLayout Layout = wellKnownLayout{issuer: realmIssuer}
+	// SingleIssuerLayout ignores the realm, the issuer is the base path.
+	// Suits Google or Azure AD, whose tenant is part of the base path.
+	SingleIssuerLayout Layout = wellKnownLayout{issuer: baseIssuer}
+	// Auth0Layout is SingleIssuerLayout with the trailing slash Auth0 puts
+	// in its issuer.
+	Auth0Layout Layout = wellKnownLayout{issuer: func(basePath, _ string) string {
+		return basePath + urlSeparator
+	}}
+	// OktaLayout targets Okta custom authorization servers, the realm being
+	// the authorization server id: {basePath}/oauth2/{realm}.
+	OktaLayout Layout = wellKnownLayout{issuer: func(basePath, realm string) string {
+		return basePath + "/oauth2/" + realm
+	}}
+	// OAuthServerLayout reads RFC 8414 authorization server metadata, whose
+	// well-known path goes between the host and the issuer path.
+	OAuthServerLayout Layout = wellKnownLayout{issuer: realmIssuer, rfc8414: true}
+)
+
+type wellKnownLayout struct {
+	issuer  func(basePath, realm string) string
+	rfc8414 bool
+}
+
+func (l wellKnownLayout) Issuer(basePath, realm string) string {
+	return l.issuer(basePath, realm)
+}
+
+func (l wellKnownLayout) DiscoveryURL(basePath, realm string) string {
+	issuer := strings.TrimRight(l.Issuer(basePath, realm), urlSeparator)
+	if !l.rfc8414 {
+		return issuer + openIDConfigurationPath
+	}
+	u, err := url.Parse(issuer)
+	if err != nil || len(u.Host) == 0 {
+		return issuer + oauthServerMetadataPath
+	}
+	u.Path = oauthServerMetadataPath + u.Path
+	u.RawPath = ""
+	return u.String()
+}
+
+func realmIssuer(basePath, realm string) string {
+	if len(realm) == 0 {
+		return basePath
+	}
+	return basePath + urlSeparator + realm
+}
+
+func baseIssuer(basePath, _ string) string {
+	return basePath
+}
+
+// WithLayout selects how the issuer and the discovery document of a realm
+// are located. The default is KeycloakLayout.
+func WithLayout(layout Layout) Option {
+	return func(cm *certManager) {
+		cm.layout = layout
+	}
+}
+
+// WithJWKSURI skips discovery and always reads keys from jwksURI.
+func WithJWKSURI(jwksURI string) Option {
+	return func(cm *certManager) {
+		cm.jwksURI = jwksURI
+	}
+}
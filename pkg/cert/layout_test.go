@@ -0,0 +1,97 @@
+package cert
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"testing"
+)
+
+func Test_Layout(t *testing.T) {
+	tests := []struct {
+		name          string
+		layout        Layout
+		basePath      string
+		realm         string
+		wantIssuer    string
+		wantDiscovery string
+	}{
+		{
+			name:          "keycloak",
+			layout:        KeycloakLayout,
+			basePath:      "https://idm/realms",
+			realm:         "test",
+			wantIssuer:    "https://idm/realms/test",
+			wantDiscovery: "https://idm/realms/test/.well-known/openid-configuration",
+		},
+		{
+			name:          "single issuer",
+			layout:        SingleIssuerLayout,
+			basePath:      "https://login.microsoftonline.com/tenant/v2.0",
+			realm:         "ignored",
+			wantIssuer:    "https://login.microsoftonline.com/tenant/v2.0",
+			wantDiscovery: "https://login.microsoftonline.com/tenant/v2.0/.well-known/openid-configuration",
+		},
+		{
+			name:          "auth0",
+			layout:        Auth0Layout,
+			basePath:      "https://tenant.auth0.com",
+			wantIssuer:    "https://tenant.auth0.com/",
+			wantDiscovery: "https://tenant.auth0.com/.well-known/openid-configuration",
+		},
+		{
+			name:          "okta",
+			layout:        OktaLayout,
+			basePath:      "https://org.okta.com",
+			realm:         "aus1a2b3c",
+			wantIssuer:    "https://org.okta.com/oauth2/aus1a2b3c",
+			wantDiscovery: "https://org.okta.com/oauth2/aus1a2b3c/.well-known/openid-configuration",
+		},
+		{
+			name:          "rfc 8414 with path",
+			layout:        OAuthServerLayout,
+			basePath:      "https://as.example.com/issuer",
+			realm:         "tenant",
+			wantIssuer:    "https://as.example.com/issuer/tenant",
+			wantDiscovery: "https://as.example.com/.well-known/oauth-authorization-server/issuer/tenant",
+		},
+		{
+			name:          "rfc 8414 without path",
+			layout:        OAuthServerLayout,
+			basePath:      "https://as.example.com",
+			wantIssuer:    "https://as.example.com",
+			wantDiscovery: "https://as.example.com/.well-known/oauth-authorization-server",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.layout.Issuer(tt.basePath, tt.realm); got != tt.wantIssuer {
+				t.Errorf("Issuer() got = %v, want %v", got, tt.wantIssuer)
+			}
+			if got := tt.layout.DiscoveryURL(tt.basePath, tt.realm); got != tt.wantDiscovery {
+				t.Errorf("DiscoveryURL() got = %v, want %v", got, tt.wantDiscovery)
+			}
+		})
+	}
+}
+
+func Test_certManager_WithJWKSURI(t *testing.T) {
+	var requested []string
+	client := &HttpClientCustomMock{
+		DoMock: func(req *http.Request) (*http.Response, error) {
+			requested = append(requested, req.URL.String())
+			return &http.Response{
+				StatusCode: http.StatusOK,
+				Header:     jsonHeader,
+				Body:       ioutil.NopCloser(bytes.NewBufferString(respCerts)),
+			}, nil
+		},
+	}
+	cm := NewCertManager("https://idm/realms", client, WithJWKSURI("https://idm/keys"))
+	if _, err := cm.Cert(keycloakKid, "test"); err != nil {
+		t.Fatalf("Cert() error = %v", err)
+	}
+	if len(requested) != 1 || requested[0] != "https://idm/keys" {
+		t.Errorf("requested = %v, want only https://idm/keys", requested)
+	}
+}
@@ -0,0 +1,43 @@
+package cert
+
+import (
+	"log/slog"
+)
+
+// WithLogger logs key rotations at info level, failed refreshes and circuit
+// breaker trips at warn or error level, and retries at debug level.
+func WithLogger(l *slog.Logger) Option {
+	return func(cm *certManager) {
+		cm.logger = l
+	}
+}
+
+// logKeyChanges logs the kids of next that are not in prev and the other way
+// round. The first key set of a realm is logged whole.
+func (cm certManager) logKeyChanges(prev, next *keySet) {
+	if prev == nil {
+		cm.logger.Info("keys loaded", "realm", next.Realm, "kids", kids(next.Keys, nil))
+		return
+	}
+	if added := kids(next.Keys, prev.Keys); len(added) > 0 {
+		cm.logger.Info("keys added", "realm", next.Realm, "kids", added)
+	}
+	if removed := kids(prev.Keys, next.Keys); len(removed) > 0 {
+		cm.logger.Info("keys removed", "realm", next.Realm, "kids", removed)
+	}
+}
+
+// kids returns the kids of keys missing from except.
+func kids(keys, except []Cert) []string {
+	known := make(map[string]bool, len(except))
+	for _, k := range except {
+		known[k.Kid] = true
+	}
+	var out []string
+	for _, k := range keys {
+		if !known[k.Kid] {
+			out = append(out, k.Kid)
+		}
+	}
+	return out
+}
@@ -0,0 +1,76 @@
+package cert
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"log/slog"
+	"net/http"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+// logRecords decodes the records written by a slog JSON handler.
+func logRecords(t *testing.T, buf *bytes.Buffer) []map[string]interface{} {
+	t.Helper()
+	var records []map[string]interface{}
+	dec := json.NewDecoder(buf)
+	for dec.More() {
+		var r map[string]interface{}
+		if err := dec.Decode(&r); err != nil {
+			t.Fatalf("log record: %v", err)
+		}
+		records = append(records, r)
+	}
+	return records
+}
+
+func Test_certManager_Logger(t *testing.T) {
+	keys := respCerts
+	rotated := strings.Replace(respCerts, keycloakKid, "rotated", 1)
+	idp := &flakyIdP{}
+	client := idp.client().(*HttpClientCustomMock)
+	do := client.DoMock
+	client.DoMock = func(req *http.Request) (*http.Response, error) {
+		resp, err := do(req)
+		if err == nil && strings.HasSuffix(req.URL.Path, "certs") {
+			resp.Body = ioutil.NopCloser(bytes.NewBufferString(keys))
+		}
+		return resp, err
+	}
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	opts := append([]Option{WithLogger(logger), WithDiscoveryTTL(0), WithKeySetTTL(0)}, testIdP...)
+	cm := NewCertManager("test", client, opts...)
+
+	_, _ = cm.Cert(keycloakKid, "test")
+	keys = rotated
+	_, _ = cm.Cert("rotated", "test")
+	idp.failures = []error{syscall.ECONNRESET}
+	_, _ = cm.Cert("rotated", "test")
+
+	want := []struct {
+		level, msg, kids string
+	}{
+		{"INFO", "keys loaded", keycloakKid},
+		{"INFO", "keys added", "rotated"},
+		{"INFO", "keys removed", keycloakKid},
+		{"ERROR", "key refresh failed", ""},
+	}
+	records := logRecords(t, &buf)
+	if len(records) != len(want) {
+		t.Fatalf("records = %v, want %d", records, len(want))
+	}
+	for i, w := range want {
+		r := records[i]
+		if r["level"] != w.level || r["msg"] != w.msg || r["realm"] != "test" {
+			t.Errorf("record %d = %v, want %s %q", i, r, w.level, w.msg)
+		}
+		if len(w.kids) > 0 {
+			if kids, _ := r["kids"].([]interface{}); len(kids) != 1 || kids[0] != w.kids {
+				t.Errorf("record %d kids = %v, want [%s]", i, r["kids"], w.kids)
+			}
+		}
+	}
+}
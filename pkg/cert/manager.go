@@ -2,114 +2,339 @@ package cert
 
 import (
 	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
 	"crypto/rsa"
-	"encoding/base64"
-	"encoding/binary"
-	"encoding/json"
+	"crypto/x509"
 	"errors"
 	"fmt"
-	"math/big"
-	"net/http"
+	"log/slog"
 	"strings"
+	"time"
+
+	"github.com/marcosgmgm/openid-decode-token/internal/instrument"
+	"github.com/marcosgmgm/openid-decode-token/pkg/metrics"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
 )
 
 const (
-	configurationURLPattern = "%s/%s/.well-known/openid-configuration"
 	urlSeparator  string = "/"
+	// DefaultKeySetTTL is how long a key set is served from memory unless
+	// WithKeySetTTL says otherwise.
+	DefaultKeySetTTL = 5 * time.Minute
+	// keySetMissInterval is how old a cached key set must be before an
+	// unknown kid refreshes it, so that made-up kids cannot flood the
+	// identity provider.
+	keySetMissInterval = 10 * time.Second
 )
 
 type certManager struct {
 	basePath string
 	httpClient HttpClient
+	x5cRoots *x509.CertPool
+	x5cVerified *x5cCache
+	diskCache *diskCache
+	responses *responseCache
+	layout Layout
+	jwksURI string
+	discoveries *discoveryCache
+	skipIssuerCheck bool
+	maxResponseSize int64
+	requestTimeout time.Duration
+	insecureHTTP bool
+	allowedJWKSHosts map[string]bool
+	retry retryPolicy
+	breaker *circuitBreaker
+	keySets *keySetCache
+	refreshes *refreshGroup
+	keySetTTL time.Duration
+	missInterval time.Duration
+	recorder metrics.Recorder
+	tracer trace.Tracer
+	logger *slog.Logger
+	policy keyPolicy
+}
+
+// Option customizes the manager built by NewCertManager.
+type Option func(*certManager)
+
+// WithRecorder reports key set fetches and sizes to r.
+func WithRecorder(r metrics.Recorder) Option {
+	return func(cm *certManager) {
+		cm.recorder = r
+	}
 }
 
-func NewCertManager(basePath string, httpClient HttpClient) Manager {
-	return certManager{
+// WithKeySetTTL sets how long the key set of a realm is served from memory
+// before it is requested again, five minutes by default. A kid missing from
+// the set refreshes it sooner. A zero ttl requests it on every key lookup.
+func WithKeySetTTL(ttl time.Duration) Option {
+	return func(cm *certManager) {
+		cm.keySetTTL = ttl
+	}
+}
+
+func NewCertManager(basePath string, httpClient HttpClient, opts ...Option) Manager {
+	cm := certManager{
 		basePath:    strings.TrimRight(basePath, urlSeparator),
 		httpClient: httpClient,
+		responses: newResponseCache(),
+		x5cVerified: newX5cCache(),
+		layout: KeycloakLayout,
+		discoveries: newDiscoveryCache(defaultDiscoveryTTL),
+		maxResponseSize: defaultMaxResponseSize,
+		requestTimeout: defaultRequestTimeout,
+		allowedJWKSHosts: make(map[string]bool),
+		retry: retryPolicy{attempts: 1},
+		keySets: newKeySetCache(),
+		refreshes: newRefreshGroup(),
+		keySetTTL: DefaultKeySetTTL,
+		missInterval: keySetMissInterval,
+		recorder: metrics.Nop{},
+		tracer: noop.NewTracerProvider().Tracer(instrumentationName),
+		logger: instrument.DiscardLogger,
+		policy: defaultKeyPolicy(),
+	}
+	for _, opt := range opts {
+		opt(&cm)
 	}
+	return cm
 }
 
 func (cm certManager) PublicKey(cert *Cert) (*rsa.PublicKey, error) {
-	decN, err := base64.RawURLEncoding.DecodeString(cert.N)
+	key, err := cm.rsaKey(cert)
 	if err != nil {
 		return nil, err
 	}
+	if _, err = cm.policy.check(key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
 
-	nInt := big.NewInt(0)
-	nInt.SetBytes(decN)
-
-	decE, err := base64.RawURLEncoding.DecodeString(cert.E)
+// Key builds the *rsa.PublicKey or *ecdsa.PublicKey of cert.
+func (cm certManager) Key(cert *Cert) (crypto.PublicKey, error) {
+	key, err := cm.buildKey(cert)
 	if err != nil {
 		return nil, err
 	}
+	if _, err = cm.policy.check(key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
 
-	var eBytes []byte
-	if len(decE) < 8 {
-		eBytes = make([]byte, 8-len(decE), 8)
-		eBytes = append(eBytes, decE...)
-	} else {
-		eBytes = decE
+// buildKey builds the key of cert without applying the key policy.
+func (cm certManager) buildKey(cert *Cert) (crypto.PublicKey, error) {
+	switch cert.Kty {
+	case "RSA":
+		key, err := cm.rsaKey(cert)
+		if err != nil {
+			return nil, err
+		}
+		return key, nil
+	case "EC":
+		if cm.x5cRoots != nil {
+			key, err := cm.x5cKey(cert)
+			if err != nil {
+				return nil, err
+			}
+			if _, ok := key.(*ecdsa.PublicKey); !ok {
+				return nil, fmt.Errorf("%w: %T for an EC key", ErrX5cKeyMismatch, key)
+			}
+			return key, nil
+		}
+		key, err := ecPublicKey(cert)
+		if err != nil {
+			return nil, err
+		}
+		return key, nil
 	}
+	return nil, fmt.Errorf("%w: %q", ErrUnsupportedKeyType, cert.Kty)
+}
 
-	eReader := bytes.NewReader(eBytes)
-	var eInt uint64
-	err = binary.Read(eReader, binary.BigEndian, &eInt)
+func (cm certManager) rsaKey(cert *Cert) (*rsa.PublicKey, error) {
+	if cm.x5cRoots == nil {
+		return rsaPublicKey(cert)
+	}
+	key, err := cm.x5cKey(cert)
 	if err != nil {
 		return nil, err
 	}
-
-	pKey := rsa.PublicKey{N: nInt, E: int(eInt)}
-	return &pKey, nil
+	rsaKey, ok := key.(*rsa.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("%w: %T for an RSA key", ErrX5cKeyMismatch, key)
+	}
+	return rsaKey, nil
 }
 
+// x5cKey returns the key of the x5c chain of cert, verified when its key set
+// was loaded or now for keys that were not.
+func (cm certManager) x5cKey(cert *Cert) (crypto.PublicKey, error) {
+	if key, ok := cm.x5cVerified.lookup(cert); ok {
+		return key, nil
+	}
+	key, _, err := x5cPublicKey(cert, cm.x5cRoots)
+	return key, err
+}
 
 func (cm certManager) Cert(kid, realm string) (*Cert, error) {
-	//Get configurations
-	urlConfiguration := fmt.Sprintf(configurationURLPattern, cm.basePath, realm)
-	reqConf, _ := http.NewRequest(http.MethodGet, urlConfiguration, nil)
-	resp, err := cm.httpClient.Do(reqConf)
+	return cm.CertContext(context.Background(), kid, realm)
+}
+
+func (cm certManager) CertContext(ctx context.Context, kid, realm string) (c *Cert, err error) {
+	ctx, span := cm.tracer.Start(ctx, "cert.Cert", trace.WithAttributes(attrRealm.String(realm), attrKid.String(kid)))
+	defer func() { instrument.EndSpan(span, err) }()
+	if ks, ok := cm.cachedKeySet(realm); ok {
+		span.SetAttributes(attrCacheHit.Bool(true))
+		c, err = findCert(ks.Keys, kid)
+		if err == nil || time.Since(ks.FetchedAt) < cm.missInterval {
+			return c, err
+		}
+		// The kid may belong to a key the identity provider rotated in.
+	}
+	span.SetAttributes(attrCacheHit.Bool(false))
+	keys, err := cm.refreshKeySet(ctx, realm)
 	if err != nil {
 		return nil, err
 	}
-	if resp.StatusCode < 200 || resp.StatusCode > 299 {
-		return nil, fmt.Errorf("error get configuration. Response code: %d. Url: %s", resp.StatusCode, urlConfiguration)
+	return findCert(keys, kid)
+}
+
+// KeySet returns every key the realm publishes.
+func (cm certManager) KeySet(ctx context.Context, realm string) (keys []Cert, err error) {
+	ctx, span := cm.tracer.Start(ctx, "cert.KeySet", trace.WithAttributes(attrRealm.String(realm)))
+	defer func() { instrument.EndSpan(span, err) }()
+	return cm.keySet(ctx, realm)
+}
+
+// keySet returns the key set of realm, from memory while it is younger than
+// the key set TTL.
+func (cm certManager) keySet(ctx context.Context, realm string) ([]Cert, error) {
+	if ks, ok := cm.cachedKeySet(realm); ok {
+		trace.SpanFromContext(ctx).SetAttributes(attrCacheHit.Bool(true))
+		return ks.Keys, nil
+	}
+	trace.SpanFromContext(ctx).SetAttributes(attrCacheHit.Bool(false))
+	return cm.refreshKeySet(ctx, realm)
+}
+
+func (cm certManager) cachedKeySet(realm string) (*keySet, bool) {
+	ks, ok := cm.keySets.lookup(realm)
+	if !ok || time.Since(ks.FetchedAt) >= cm.keySetTTL {
+		return nil, false
 	}
-	type ConfigRealm struct {
-		URLKeys string `json:"jwks_uri"`
+	return ks, true
+}
+
+// refreshKeySet fetches the key set of realm, once for all the lookups that
+// need it at the same time.
+func (cm certManager) refreshKeySet(ctx context.Context, realm string) ([]Cert, error) {
+	return cm.refreshes.do(ctx, realm, func(ctx context.Context) ([]Cert, error) {
+		return cm.loadKeySet(ctx, realm)
+	})
+}
+
+func (cm certManager) loadKeySet(ctx context.Context, realm string) ([]Cert, error) {
+	prev, _ := cm.keySets.lookup(realm)
+	ks, err := cm.fetchKeySet(ctx, realm)
+	if err != nil {
+		cached, ok := cm.lastKnownGood(realm, err)
+		if !ok {
+			cm.logger.Error("key refresh failed", "realm", realm, "error", err)
+			return nil, err
+		}
+		cm.logger.Warn("key refresh failed, using last known good keys", "realm", realm, "error", err, "fetched_at", cached.FetchedAt)
+		trace.SpanFromContext(ctx).AddEvent("serving last known good keys", trace.WithAttributes(attribute.String("error", err.Error())))
+		return cached.Keys, nil
 	}
-	var jr ConfigRealm
-	defer resp.Body.Close()
-	if err = json.NewDecoder(resp.Body).Decode(&jr); err != nil {
-		return nil, err
+	cm.logKeyChanges(prev, ks)
+	if cm.x5cRoots != nil {
+		cm.x5cVerified.load(realm, ks.Keys, cm.x5cRoots)
 	}
-	//Get keys
-	reqCerts, _ := http.NewRequest(http.MethodGet, jr.URLKeys, nil)
-	respKeys, err := cm.httpClient.Do(reqCerts)
+	cm.reportRejectedKeys(realm, ks.Keys)
+	cm.keySets.store(ks)
+	cm.recorder.CachedKeys(realm, len(ks.Keys))
+	if cm.diskCache != nil {
+		// The cache is best effort, a failed write must not fail validation.
+		if err = cm.diskCache.store(ks); err != nil {
+			cm.logger.Warn("disk cache write failed", "realm", realm, "error", err)
+		}
+	}
+	return ks.Keys, nil
+}
+
+// lastKnownGood returns the keys to use when fetching failed with err: the
+// keys in memory while the circuit breaker is open, otherwise the disk cache.
+// Only an unavailable identity provider falls back; a document or key set
+// that was rejected is reported as is.
+func (cm certManager) lastKnownGood(realm string, err error) (*keySet, bool) {
+	if errors.Is(err, ErrIdPUnavailable) {
+		if ks, ok := cm.keySets.lookup(realm); ok {
+			return ks, true
+		}
+	}
+	if cm.diskCache == nil || !isUnavailable(err) {
+		return nil, false
+	}
+	return cm.diskCache.lastKnownGood(realm)
+}
+
+func (cm certManager) fetchKeySet(ctx context.Context, realm string) (*keySet, error) {
+	jwksURI, err := cm.keysURL(ctx, realm)
 	if err != nil {
 		return nil, err
 	}
-	if respKeys.StatusCode < 200 || respKeys.StatusCode > 299 {
-		return nil, fmt.Errorf("error get keys. Response code: %d. Url: %s", respKeys.StatusCode, jr.URLKeys)
+	//Get keys
+	if cm.diskCache != nil {
+		cm.primeFromDisk(realm, jwksURI)
 	}
-	defer respKeys.Body.Close()
-	type kResp struct {
-		Keys []Cert `json:"keys"`
+	jwks, err := cm.fetch(ctx, realm, jwksURI, metrics.DocumentKeys)
+	if err != nil {
+		return nil, err
 	}
-	var kr kResp
-	if err = json.NewDecoder(respKeys.Body).Decode(&kr); err != nil {
+	keys, err := decodeKeySet(bytes.NewReader(jwks.body))
+	if err != nil {
 		return nil, err
 	}
-	cert := Cert{}
-	for _, k := range kr.Keys {
-		if k.Kid == kid {
-			cert = k
-			break
+	return &keySet{
+		Realm:     realm,
+		JWKSURI:   jwksURI,
+		ETag:      jwks.etag,
+		FetchedAt: time.Now(),
+		Keys:      keys,
+	}, nil
+}
+
+func (cm certManager) keysURL(ctx context.Context, realm string) (string, error) {
+	if len(cm.jwksURI) > 0 {
+		if !strings.HasPrefix(cm.jwksURI, "https://") && !cm.insecureHTTP {
+			return "", fmt.Errorf("%w: %s", ErrInsecureJWKSURI, cm.jwksURI)
 		}
+		return cm.jwksURI, nil
+	}
+	md, err := cm.Discover(ctx, realm)
+	if err != nil {
+		return "", err
+	}
+	if len(md.JWKSURI) == 0 {
+		return "", ErrMissingJWKSURI
 	}
-	if len(cert.E) == 0 {
-		return nil, errors.New("no has key")
+	if err = cm.checkJWKSURI(realm, md.JWKSURI); err != nil {
+		return "", err
+	}
+	return md.JWKSURI, nil
+}
+
+func findCert(keys []Cert, kid string) (*Cert, error) {
+	for _, k := range keys {
+		if k.Kid == kid && (len(k.E) > 0 || len(k.X) > 0) {
+			return &k, nil
+		}
 	}
-	return &cert, nil
+	return nil, errors.New("no has key")
 }
 
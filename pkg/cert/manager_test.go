@@ -2,18 +2,24 @@ package cert
 
 import (
 	"bytes"
+	"context"
 	"crypto/rand"
 	"crypto/rsa"
 	"encoding/base64"
-	"encoding/binary"
 	"errors"
 	"io/ioutil"
+	"math/big"
 	"net/http"
 	"reflect"
 	"testing"
 )
 
-var respConfiguration = "{\"jwks_uri\":\"http://base/test/protocol/openid-connect/certs\"}"
+var jsonHeader = http.Header{"Content-Type": []string{"application/json"}}
+
+// testIdP allows the plain http jwks_uri of respConfiguration.
+var testIdP = []Option{WithInsecureHTTP(), WithAllowedJWKSHosts("base")}
+
+var respConfiguration = "{\"issuer\":\"test/test\",\"jwks_uri\":\"http://base/test/protocol/openid-connect/certs\"}"
 var respCerts = "{\"keys\":[{\"kid\":\"1h_MHweQR-g8osNYJvhd-FZ4s2lJ52PRm0G68jsuLPc\"," +
 	"\"kty\":\"RSA\",\"alg\":\"RS256\",\"use\":\"sig\"," +
 	"\"n\":\"h702HSgRKkAOkJrKG0-NZ-LtzhiKpxu401STa_-YmRkrugQKGxfGtIH3EUG965_6MM7NCkG-8q90KbfWuXa9wAgJ" +
@@ -35,9 +41,7 @@ var respCerts = "{\"keys\":[{\"kid\":\"1h_MHweQR-g8osNYJvhd-FZ4s2lJ52PRm0G68jsuL
 func Test_certManager_PublicKey(t *testing.T) {
 	_, pub, _ := generateKeys()
 	n := base64.RawURLEncoding.EncodeToString(pub.N.Bytes())
-	buf := new(bytes.Buffer)
-	binary.Write(buf, binary.BigEndian, uint64(pub.E))
-	e := base64.RawURLEncoding.EncodeToString(buf.Bytes())
+	e := base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes())
 	type fields struct {
 		basePath string
 	}
@@ -148,6 +152,7 @@ func Test_certManager_Cert(t *testing.T) {
 							return &http.Response{
 								Status:     "ok",
 								StatusCode: http.StatusOK,
+								Header:     jsonHeader,
 								Body:       ioutil.NopCloser(bytes.NewBufferString(respConfiguration)),
 							}, nil
 						}
@@ -155,6 +160,7 @@ func Test_certManager_Cert(t *testing.T) {
 							return &http.Response{
 								Status:     "ok",
 								StatusCode: http.StatusOK,
+								Header:     jsonHeader,
 								Body:       ioutil.NopCloser(bytes.NewBufferString(respCerts)),
 							}, nil
 						}
@@ -169,6 +175,7 @@ func Test_certManager_Cert(t *testing.T) {
 			want: &Cert{
 				Kty: "RSA",
 				Use: "sig",
+				Alg: "RS256",
 				Kid: "1h_MHweQR-g8osNYJvhd-FZ4s2lJ52PRm0G68jsuLPc",
 				X5t: "aIYlyLZDg4jL04kci2shPZkZh04",
 				N: "h702HSgRKkAOkJrKG0-NZ-LtzhiKpxu401STa_-YmRkrugQKGxfGtIH3EUG965_6MM7NCkG-8q90KbfWuXa9wAgJmuWIm" +
@@ -186,6 +193,7 @@ func Test_certManager_Cert(t *testing.T) {
 					"KYFNTrAGiPtp8Kow0QIbvJuxEWlxwVMRLKJfVeQ7UDGt75pr1kjxGCuCEdqwqfTyBD6QRTz5Nk9HtU9XrxQv2r70i9+5g1j" +
 					"3HYZuDot/+qMDznrFPF/WS6Hk2cVzep9jAvKCWnICLAJ4d9SsRjN3GvoliPzbPbWn9PNbELrdBLIVTIlCmh8OO/hb2S1pVtd" +
 					"7PgZVZHWcec+292ze0Qv3x+T1f2tWUmFbHzv34PEMrWTIfkjZLOMDA="},
+				X5tS256: "jJp8SlGC0m6-BjqDGdVFaU8lS2PntucDgbQcKvaQsmg",
 			},
 			wantErr: nil,
 			wantErrBol: false,
@@ -245,6 +253,7 @@ func Test_certManager_Cert(t *testing.T) {
 							return &http.Response{
 								Status:     "ok",
 								StatusCode: http.StatusOK,
+								Header:     jsonHeader,
 								Body:       ioutil.NopCloser(bytes.NewBufferString(respConfiguration)),
 							}, nil
 						}
@@ -273,6 +282,7 @@ func Test_certManager_Cert(t *testing.T) {
 							return &http.Response{
 								Status:     "ok",
 								StatusCode: http.StatusOK,
+								Header:     jsonHeader,
 								Body:       ioutil.NopCloser(bytes.NewBufferString(respConfiguration)),
 							}, nil
 						}
@@ -297,7 +307,7 @@ func Test_certManager_Cert(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			cm := NewCertManager(tt.fields.basePath, tt.fields.httpClient)
+			cm := NewCertManager(tt.fields.basePath, tt.fields.httpClient, testIdP...)
 			got, err := cm.Cert(tt.args.kid, tt.args.realm)
 			if (err != nil) != tt.wantErrBol {
 				t.Errorf("Cert() error = %v, wantErr %v", err, tt.wantErrBol)
@@ -315,3 +325,12 @@ func Test_certManager_Cert(t *testing.T) {
 		})
 	}
 }
+
+func Test_certManager_KeySet(t *testing.T) {
+	idp := &flakyIdP{}
+	cm := NewCertManager("test", idp.client(), testIdP...).(KeySetManager)
+	keys, err := cm.KeySet(context.Background(), "test")
+	if err != nil || len(keys) != 1 || keys[0].Kid != keycloakKid {
+		t.Fatalf("KeySet() = %v, %v", keys, err)
+	}
+}
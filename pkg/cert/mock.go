@@ -1,6 +1,7 @@
 package cert
 
 import (
+	"context"
 	"crypto/rsa"
 	"net/http"
 )
@@ -8,6 +9,7 @@ import (
 type ManagerCustomMock struct {
 	CertMock      func(kid, realm string) (*Cert, error)
 	PublicKeyMock func(cert *Cert) (*rsa.PublicKey, error)
+	KeySetMock    func(ctx context.Context, realm string) ([]Cert, error)
 }
 
 func (m ManagerCustomMock) Cert(kid, realm string) (*Cert, error) {
@@ -18,6 +20,10 @@ func (m ManagerCustomMock) PublicKey(cert *Cert) (*rsa.PublicKey, error) {
 	return m.PublicKeyMock(cert)
 }
 
+func (m ManagerCustomMock) KeySet(ctx context.Context, realm string) ([]Cert, error) {
+	return m.KeySetMock(ctx, realm)
+}
+
 type HttpClientCustomMock struct {
 	DoMock func(req *http.Request) (*http.Response, error)
 }
@@ -0,0 +1,87 @@
+package cert
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"errors"
+	"fmt"
+
+	"github.com/marcosgmgm/openid-decode-token/pkg/metrics"
+)
+
+// ErrKeyRejected is returned for published keys the key policy does not allow.
+var ErrKeyRejected = errors.New("key rejected by policy")
+
+// DefaultMinRSABits is the smallest RSA modulus, in bits, the default key
+// policy allows.
+const DefaultMinRSABits = 2048
+
+type keyPolicy struct {
+	minRSABits int
+	curves     map[string]bool
+}
+
+func newKeyPolicy(minRSABits int, curves ...string) keyPolicy {
+	p := keyPolicy{minRSABits: minRSABits, curves: make(map[string]bool, len(curves))}
+	for _, crv := range curves {
+		p.curves[crv] = true
+	}
+	return p
+}
+
+func defaultKeyPolicy() keyPolicy {
+	return newKeyPolicy(DefaultMinRSABits, "P-256", "P-384", "P-521")
+}
+
+// WithKeyPolicy sets the smallest RSA modulus, in bits, and the EC curves the
+// manager builds keys for. Other keys fail with an error matching
+// ErrKeyRejected. The default is DefaultMinRSABits and P-256, P-384 and P-521.
+func WithKeyPolicy(minRSABits int, curves ...string) Option {
+	return func(cm *certManager) {
+		cm.policy = newKeyPolicy(minRSABits, curves...)
+	}
+}
+
+// WithStaticKeyPolicy is WithKeyPolicy for the managers over pinned keys,
+// which apply the default policy otherwise.
+func WithStaticKeyPolicy(minRSABits int, curves ...string) StaticOption {
+	return func(sm *staticManager) {
+		sm.policy = newKeyPolicy(minRSABits, curves...)
+	}
+}
+
+// check returns the metrics.Rejection reason and an error for a key the
+// policy does not allow.
+func (p keyPolicy) check(key crypto.PublicKey) (string, error) {
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		if bits := k.N.BitLen(); bits < p.minRSABits {
+			return metrics.RejectionWeakRSAKey, fmt.Errorf("%w: %d bit RSA key, at least %d required", ErrKeyRejected, bits, p.minRSABits)
+		}
+	case *ecdsa.PublicKey:
+		if crv := k.Curve.Params().Name; !p.curves[crv] {
+			return metrics.RejectionCurveNotAllowed, fmt.Errorf("%w: curve %s is not allowed", ErrKeyRejected, crv)
+		}
+	default:
+		return metrics.RejectionKeyType, fmt.Errorf("%w: %T", ErrKeyRejected, key)
+	}
+	return "", nil
+}
+
+// reportRejectedKeys logs and records the keys of a refreshed key set that
+// the policy rejects: they point at a misconfigured or compromised identity
+// provider. Lookups of those keys then fail with ErrKeyRejected without
+// being reported again.
+func (cm certManager) reportRejectedKeys(realm string, keys []Cert) {
+	for i := range keys {
+		key, err := cm.buildKey(&keys[i])
+		if err != nil {
+			continue
+		}
+		if reason, err := cm.policy.check(key); err != nil {
+			cm.logger.Warn("key rejected by policy", "realm", realm, "kid", keys[i].Kid, "kty", keys[i].Kty, "reason", reason, "error", err)
+			cm.recorder.KeyRejected(realm, reason)
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package cert
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"errors"
+	"log/slog"
+	"math/big"
+	"reflect"
+	"testing"
+
+	"github.com/marcosgmgm/openid-decode-token/pkg/metrics"
+)
+
+func rsaJWK(t *testing.T, bits int) *Cert {
+	t.Helper()
+	pk, err := rsa.GenerateKey(rand.Reader, bits)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &Cert{
+		Kty: "RSA",
+		Kid: "rsa",
+		N:   base64.RawURLEncoding.EncodeToString(pk.N.Bytes()),
+		E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pk.E)).Bytes()),
+	}
+}
+
+func ecJWK(t *testing.T, curve elliptic.Curve) *Cert {
+	t.Helper()
+	pk, err := ecdsa.GenerateKey(curve, rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	size := (curve.Params().BitSize + 7) / 8
+	return &Cert{
+		Kty: "EC",
+		Kid: "ec",
+		Crv: curve.Params().Name,
+		X:   base64.RawURLEncoding.EncodeToString(pk.X.FillBytes(make([]byte, size))),
+		Y:   base64.RawURLEncoding.EncodeToString(pk.Y.FillBytes(make([]byte, size))),
+	}
+}
+
+func Test_certManager_KeyPolicy(t *testing.T) {
+	rsa1024, rsa2048 := rsaJWK(t, 1024), rsaJWK(t, 2048)
+	p256, p384 := ecJWK(t, elliptic.P256()), ecJWK(t, elliptic.P384())
+	tests := []struct {
+		name       string
+		opts       []Option
+		cert       *Cert
+		wantReason string
+	}{
+		{name: "2048 bit RSA key", cert: rsa2048},
+		{name: "1024 bit RSA key", cert: rsa1024, wantReason: metrics.RejectionWeakRSAKey},
+		{name: "1024 bit RSA key allowed", opts: []Option{WithKeyPolicy(1024)}, cert: rsa1024},
+		{name: "2048 bit RSA key below the minimum", opts: []Option{WithKeyPolicy(3072)}, cert: rsa2048, wantReason: metrics.RejectionWeakRSAKey},
+		{name: "P-256 key", cert: p256},
+		{name: "P-384 key", cert: p384},
+		{name: "P-384 key not allowed", opts: []Option{WithKeyPolicy(2048, "P-256")}, cert: p384, wantReason: metrics.RejectionCurveNotAllowed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cm := NewCertManager("test", nil, tt.opts...).(certManager)
+			key, err := cm.Key(tt.cert)
+			if tt.wantReason == "" {
+				if err != nil || key == nil {
+					t.Fatalf("Key() = %v, %v", key, err)
+				}
+				return
+			}
+			if !errors.Is(err, ErrKeyRejected) || key != nil {
+				t.Fatalf("Key() = %v, %v, want ErrKeyRejected", key, err)
+			}
+			built, _ := cm.buildKey(tt.cert)
+			if reason, _ := cm.policy.check(built); reason != tt.wantReason {
+				t.Errorf("check() reason = %s, want %s", reason, tt.wantReason)
+			}
+		})
+	}
+}
+
+func Test_certManager_KeyPolicyReport(t *testing.T) {
+	type rejection struct{ realm, reason string }
+	var rejections []rejection
+	var buf bytes.Buffer
+	idp := &flakyIdP{}
+	opts := append([]Option{
+		WithKeyPolicy(4096),
+		WithRecorder(metrics.RecorderCustomMock{KeyRejectedMock: func(realm, reason string) {
+			rejections = append(rejections, rejection{realm, reason})
+		}}),
+		WithLogger(slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelWarn}))),
+	}, testIdP...)
+	cm := NewCertManager("test", idp.client(), opts...)
+
+	c, err := cm.Cert(keycloakKid, "test")
+	if err != nil {
+		t.Fatalf("Cert() error = %v", err)
+	}
+	for i := 0; i < 3; i++ {
+		if _, err = cm.(KeyManager).Key(c); !errors.Is(err, ErrKeyRejected) {
+			t.Fatalf("Key() error = %v, want ErrKeyRejected", err)
+		}
+	}
+	if want := []rejection{{"test", metrics.RejectionWeakRSAKey}}; !reflect.DeepEqual(rejections, want) {
+		t.Errorf("KeyRejected() = %v, want %v", rejections, want)
+	}
+	records := logRecords(t, &buf)
+	if len(records) != 1 || records[0]["realm"] != "test" || records[0]["kid"] != keycloakKid || records[0]["reason"] != metrics.RejectionWeakRSAKey {
+		t.Errorf("log records = %v", records)
+	}
+}
+
+func Test_certManager_PublicKeyPolicy(t *testing.T) {
+	cm := NewCertManager("test", nil)
+	if _, err := cm.PublicKey(rsaJWK(t, 1024)); !errors.Is(err, ErrKeyRejected) {
+		t.Errorf("PublicKey() error = %v, want ErrKeyRejected", err)
+	}
+	if _, err := cm.PublicKey(rsaJWK(t, 2048)); err != nil {
+		t.Errorf("PublicKey() error = %v", err)
+	}
+}
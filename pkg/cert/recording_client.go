@@ -0,0 +1,185 @@
+package cert
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"sync"
+)
+
+var ErrNoFixture = errors.New("no fixture for request")
+
+// Fixture is a canned response to a request.
+type Fixture struct {
+	// Method defaults to GET.
+	Method string      `json:"method,omitempty"`
+	URL    string      `json:"url"`
+	Status int         `json:"status"`
+	Header http.Header `json:"header,omitempty"`
+	Body   string      `json:"body,omitempty"`
+	// BodyFile is read instead of Body, relative to the fixture file.
+	BodyFile string `json:"body_file,omitempty"`
+}
+
+func (f Fixture) key() string {
+	method := f.Method
+	if len(method) == 0 {
+		method = http.MethodGet
+	}
+	return method + " " + f.URL
+}
+
+// LoadFixtures reads a JSON array of fixtures from path.
+func LoadFixtures(path string) ([]Fixture, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var fixtures []Fixture
+	if err = json.Unmarshal(b, &fixtures); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	for i, f := range fixtures {
+		if len(f.BodyFile) == 0 {
+			continue
+		}
+		body, err := ioutil.ReadFile(filepath.Join(filepath.Dir(path), f.BodyFile))
+		if err != nil {
+			return nil, err
+		}
+		fixtures[i].Body = string(body)
+		fixtures[i].BodyFile = ""
+	}
+	return fixtures, nil
+}
+
+// SaveFixtures writes fixtures to path as LoadFixtures reads them.
+func SaveFixtures(path string, fixtures []Fixture) error {
+	b, err := json.MarshalIndent(fixtures, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, append(b, '\n'), 0644)
+}
+
+// RecordingClient is an HttpClient that keeps every request it sends. It
+// either replays fixtures or forwards to another client and turns the
+// responses into fixtures.
+type RecordingClient struct {
+	next     HttpClient
+	mu       sync.Mutex
+	fixtures map[string]Fixture
+	order    []string
+	requests []*http.Request
+}
+
+// NewReplayClient answers with fixtures, and with ErrNoFixture for any other
+// request.
+func NewReplayClient(fixtures ...Fixture) *RecordingClient {
+	c := &RecordingClient{fixtures: make(map[string]Fixture)}
+	for _, f := range fixtures {
+		c.add(f)
+	}
+	return c
+}
+
+// NewRecordingClient forwards requests to next and records the responses,
+// see Fixtures.
+func NewRecordingClient(next HttpClient) *RecordingClient {
+	c := NewReplayClient()
+	c.next = next
+	return c
+}
+
+func (c *RecordingClient) add(f Fixture) {
+	if _, ok := c.fixtures[f.key()]; !ok {
+		c.order = append(c.order, f.key())
+	}
+	c.fixtures[f.key()] = f
+}
+
+func (c *RecordingClient) Do(req *http.Request) (*http.Response, error) {
+	c.mu.Lock()
+	c.requests = append(c.requests, req)
+	f, ok := c.fixtures[Fixture{Method: req.Method, URL: req.URL.String()}.key()]
+	c.mu.Unlock()
+	if c.next != nil {
+		return c.record(req)
+	}
+	if !ok {
+		return nil, fmt.Errorf("%w: %s %s", ErrNoFixture, req.Method, req.URL)
+	}
+	return &http.Response{
+		Status:     http.StatusText(f.Status),
+		StatusCode: f.Status,
+		Header:     f.Header.Clone(),
+		Body:       ioutil.NopCloser(bytes.NewBufferString(f.Body)),
+		Request:    req,
+	}, nil
+}
+
+func (c *RecordingClient) record(req *http.Request) (*http.Response, error) {
+	resp, err := c.next.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.add(Fixture{
+		Method: req.Method,
+		URL:    req.URL.String(),
+		Status: resp.StatusCode,
+		Header: resp.Header.Clone(),
+		Body:   string(body),
+	})
+	return resp, nil
+}
+
+// Requests returns the requests sent so far, in order.
+func (c *RecordingClient) Requests() []*http.Request {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]*http.Request(nil), c.requests...)
+}
+
+// Count returns how many requests were sent to url.
+func (c *RecordingClient) Count(url string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	n := 0
+	for _, req := range c.requests {
+		if req.URL.String() == url {
+			n++
+		}
+	}
+	return n
+}
+
+// Fixtures returns the fixtures of the client, including the recorded
+// responses, in the order they were first seen.
+func (c *RecordingClient) Fixtures() []Fixture {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	fixtures := make([]Fixture, 0, len(c.order))
+	for _, key := range c.order {
+		fixtures = append(fixtures, c.fixtures[key])
+	}
+	return fixtures
+}
+
+// Reset forgets the requests sent so far.
+func (c *RecordingClient) Reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.requests = nil
+}
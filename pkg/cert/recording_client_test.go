@@ -0,0 +1,82 @@
+package cert
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+const (
+	fixtureDiscovery = "https://idp.example/realms/test/.well-known/openid-configuration"
+	fixtureKeys      = "https://idp.example/realms/test/protocol/openid-connect/certs"
+)
+
+func Test_RecordingClient_Replay(t *testing.T) {
+	fixtures, err := LoadFixtures(filepath.Join("testdata", "keycloak", "fixtures.json"))
+	if err != nil {
+		t.Fatalf("LoadFixtures() error = %v", err)
+	}
+	client := NewReplayClient(fixtures...)
+	cm := NewCertManager("https://idp.example/realms", client)
+	for i := 0; i < 3; i++ {
+		if _, err = cm.Cert(keycloakKid, "test"); err != nil {
+			t.Fatalf("Cert() error = %v", err)
+		}
+	}
+	// Both documents are cached.
+	if n := client.Count(fixtureDiscovery); n != 1 {
+		t.Errorf("discovery requests = %d, want 1", n)
+	}
+	if n := client.Count(fixtureKeys); n != 1 {
+		t.Errorf("keys requests = %d, want 1", n)
+	}
+
+	client.Reset()
+	if _, err = cm.Cert(keycloakKid, "other"); !errors.Is(err, ErrNoFixture) {
+		t.Errorf("Cert() error = %v, wantErr %v", err, ErrNoFixture)
+	}
+	if requests := client.Requests(); len(requests) != 1 || requests[0].Header.Get("Accept") != "application/json" {
+		t.Errorf("requests = %v", requests)
+	}
+}
+
+func Test_RecordingClient_Record(t *testing.T) {
+	idp := &HttpClientCustomMock{
+		DoMock: func(req *http.Request) (*http.Response, error) {
+			body := respCerts
+			if req.URL.String() == fixtureDiscovery {
+				body = `{"issuer":"https://idp.example/realms/test","jwks_uri":"` + fixtureKeys + `"}`
+			}
+			return &http.Response{
+				StatusCode: http.StatusOK,
+				Header:     jsonHeader,
+				Body:       ioutil.NopCloser(bytes.NewBufferString(body)),
+			}, nil
+		},
+	}
+	recorder := NewRecordingClient(idp)
+	if _, err := NewCertManager("https://idp.example/realms", recorder).Cert(keycloakKid, "test"); err != nil {
+		t.Fatalf("Cert() error = %v", err)
+	}
+	path := filepath.Join(t.TempDir(), "fixtures.json")
+	if err := SaveFixtures(path, recorder.Fixtures()); err != nil {
+		t.Fatalf("SaveFixtures() error = %v", err)
+	}
+	fixtures, err := LoadFixtures(path)
+	if err != nil {
+		t.Fatalf("LoadFixtures() error = %v", err)
+	}
+	if !reflect.DeepEqual(fixtures, recorder.Fixtures()) || len(fixtures) != 2 || fixtures[1].Body != respCerts {
+		t.Fatalf("fixtures = %+v", fixtures)
+	}
+
+	replay := NewReplayClient(fixtures...)
+	got, err := NewCertManager("https://idp.example/realms", replay).Cert(keycloakKid, "test")
+	if err != nil || got.Kid != keycloakKid {
+		t.Errorf("Cert() = %v, %v from the recorded fixtures", got, err)
+	}
+}
@@ -0,0 +1,271 @@
+package cert
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/marcosgmgm/openid-decode-token/internal/instrument"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ErrIdPUnavailable is matched by errors.Is when the circuit breaker of the
+// manager is open.
+var ErrIdPUnavailable = errors.New("identity provider unavailable")
+
+// UnavailableError is returned without contacting the identity provider
+// while the circuit breaker is open.
+type UnavailableError struct {
+	// Until is when the next request will be let through.
+	Until time.Time
+	// Err is the failure that opened the circuit.
+	Err error
+}
+
+func (e *UnavailableError) Error() string {
+	return fmt.Sprintf("%s until %s: %v", ErrIdPUnavailable, e.Until.Format(time.RFC3339), e.Err)
+}
+
+func (e *UnavailableError) Is(target error) bool {
+	return target == ErrIdPUnavailable
+}
+
+func (e *UnavailableError) Unwrap() error {
+	return e.Err
+}
+
+// retryPolicy retries transient failures with exponential backoff and full
+// jitter.
+type retryPolicy struct {
+	attempts  int
+	baseDelay time.Duration
+	maxDelay  time.Duration
+}
+
+// WithRetry makes up to attempts requests when the identity provider answers
+// with a 5xx status, times out or resets the connection. The n-th retry
+// waits a random duration up to baseDelay*2^n, capped at maxDelay.
+func WithRetry(attempts int, baseDelay, maxDelay time.Duration) Option {
+	return func(cm *certManager) {
+		cm.retry = retryPolicy{attempts: attempts, baseDelay: baseDelay, maxDelay: maxDelay}
+	}
+}
+
+func (rp retryPolicy) backoff(retry int) time.Duration {
+	d := rp.baseDelay << uint(retry)
+	if d <= 0 || d > rp.maxDelay {
+		d = rp.maxDelay
+	}
+	if d <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(d) + 1))
+}
+
+// unreachableError wraps a request that got no response at all from the
+// identity provider.
+type unreachableError struct {
+	err error
+}
+
+func (e *unreachableError) Error() string {
+	return e.err.Error()
+}
+
+func (e *unreachableError) Unwrap() error {
+	return e.err
+}
+
+// isUnavailable reports whether err means the identity provider could not
+// answer, as opposed to answering with something that was rejected.
+func isUnavailable(err error) bool {
+	var ue *unreachableError
+	return errors.As(err, &ue) || errors.Is(err, ErrIdPUnavailable) || isTransient(err)
+}
+
+func isTransient(err error) bool {
+	var se *StatusError
+	if errors.As(err, &se) {
+		return se.StatusCode >= 500
+	}
+	var ne net.Error
+	if errors.As(err, &ne) && ne.Timeout() {
+		return true
+	}
+	return errors.Is(err, context.DeadlineExceeded) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+// Circuit breaker settings used in place of a threshold or cooldown that is
+// not positive.
+const (
+	defaultBreakerThreshold = 5
+	defaultBreakerCooldown  = 30 * time.Second
+)
+
+// circuitBreaker opens after threshold consecutive transient failures and
+// lets a single trial request through once cooldown has elapsed.
+type circuitBreaker struct {
+	threshold int
+	cooldown  time.Duration
+	mu        sync.Mutex
+	failures  int
+	openUntil time.Time
+	lastErr   error
+	trial     bool
+}
+
+// WithCircuitBreaker stops calling the identity provider for cooldown after
+// threshold consecutive transient failures. Meanwhile key lookups are served
+// from the keys already fetched, or fail with an UnavailableError. A threshold
+// or cooldown that is not positive falls back to 5 failures and 30 seconds.
+func WithCircuitBreaker(threshold int, cooldown time.Duration) Option {
+	if threshold <= 0 {
+		threshold = defaultBreakerThreshold
+	}
+	if cooldown <= 0 {
+		cooldown = defaultBreakerCooldown
+	}
+	return func(cm *certManager) {
+		cm.breaker = &circuitBreaker{threshold: threshold, cooldown: cooldown}
+	}
+}
+
+func (cb *circuitBreaker) allow() error {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	if cb.failures < cb.threshold {
+		return nil
+	}
+	if time.Now().Before(cb.openUntil) || cb.trial {
+		return &UnavailableError{Until: cb.openUntil, Err: cb.lastErr}
+	}
+	cb.trial = true
+	return nil
+}
+
+// record reports whether err opened the circuit.
+func (cb *circuitBreaker) record(err error) bool {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	cb.trial = false
+	if err == nil || !isTransient(err) {
+		cb.failures = 0
+		return false
+	}
+	cb.failures++
+	cb.lastErr = err
+	if cb.failures >= cb.threshold {
+		cb.openUntil = time.Now().Add(cb.cooldown)
+		return true
+	}
+	return false
+}
+
+// fetch is get behind the circuit breaker and the retry policy.
+func (cm certManager) fetch(ctx context.Context, realm, rawURL, what string) (resp *cachedResponse, err error) {
+	ctx, span := cm.tracer.Start(ctx, "cert.fetch "+what, trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attrRealm.String(realm), attrDocument.String(what), attrURL.String(rawURL)))
+	defer func() { instrument.EndSpan(span, err) }()
+	if cm.breaker != nil {
+		if err = cm.breaker.allow(); err != nil {
+			return nil, err
+		}
+	}
+	for attempt := 0; ; attempt++ {
+		start := time.Now()
+		var statusCode int
+		resp, statusCode, err = cm.get(ctx, rawURL, what)
+		cm.recorder.DocumentFetched(realm, what, statusCode, time.Since(start))
+		span.SetAttributes(attrStatus.Int(statusCode), attrAttempts.Int(attempt+1))
+		if err == nil || !isTransient(err) || attempt+1 >= cm.retry.attempts || ctx.Err() != nil {
+			break
+		}
+		cm.logger.Debug("retrying request", "realm", realm, "document", what, "attempt", attempt+1, "error", err)
+		timer := time.NewTimer(cm.retry.backoff(attempt))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+		case <-timer.C:
+		}
+	}
+	if cm.breaker != nil && cm.breaker.record(err) {
+		cm.logger.Warn("identity provider unavailable, circuit breaker open", "realm", realm, "cooldown", cm.breaker.cooldown, "error", err)
+	}
+	return resp, err
+}
+
+// keySetCache keeps the last key set fetched for each realm in memory.
+type keySetCache struct {
+	mu   sync.RWMutex
+	sets map[string]*keySet
+}
+
+func newKeySetCache() *keySetCache {
+	return &keySetCache{sets: make(map[string]*keySet)}
+}
+
+func (kc *keySetCache) lookup(realm string) (*keySet, bool) {
+	kc.mu.RLock()
+	defer kc.mu.RUnlock()
+	ks, ok := kc.sets[realm]
+	return ks, ok
+}
+
+func (kc *keySetCache) store(ks *keySet) {
+	kc.mu.Lock()
+	defer kc.mu.Unlock()
+	kc.sets[ks.Realm] = ks
+}
+
+// refreshGroup lets the lookups that miss the key set of a realm at the same
+// time share a single refresh.
+type refreshGroup struct {
+	mu    sync.Mutex
+	calls map[string]*refreshCall
+}
+
+type refreshCall struct {
+	done chan struct{}
+	keys []Cert
+	err  error
+}
+
+func newRefreshGroup() *refreshGroup {
+	return &refreshGroup{calls: make(map[string]*refreshCall)}
+}
+
+// do runs load for realm unless a refresh of realm is in flight, and waits
+// for the result or for ctx to be done. load ignores the cancellation of ctx,
+// so that a caller giving up does not fail the others.
+func (g *refreshGroup) do(ctx context.Context, realm string, load func(context.Context) ([]Cert, error)) ([]Cert, error) {
+	g.mu.Lock()
+	c, ok := g.calls[realm]
+	if !ok {
+		c = &refreshCall{done: make(chan struct{})}
+		g.calls[realm] = c
+		go func(ctx context.Context) {
+			c.keys, c.err = load(ctx)
+			g.mu.Lock()
+			delete(g.calls, realm)
+			g.mu.Unlock()
+			close(c.done)
+		}(context.WithoutCancel(ctx))
+	}
+	g.mu.Unlock()
+
+	select {
+	case <-c.done:
+		return c.keys, c.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
@@ -0,0 +1,283 @@
+package cert
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"reflect"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/marcosgmgm/openid-decode-token/pkg/metrics"
+)
+
+// flakyIdP fails the requests listed in failures, in order, and answers the
+// others like respConfiguration and respCerts.
+type flakyIdP struct {
+	failures []error
+	requests int
+}
+
+func (f *flakyIdP) client() HttpClient {
+	return &HttpClientCustomMock{
+		DoMock: func(req *http.Request) (*http.Response, error) {
+			f.requests++
+			if len(f.failures) > 0 {
+				err := f.failures[0]
+				f.failures = f.failures[1:]
+				var se *StatusError
+				if errors.As(err, &se) {
+					return &http.Response{StatusCode: se.StatusCode}, nil
+				}
+				return nil, err
+			}
+			body := respCerts
+			if req.URL.Path == "test/test/.well-known/openid-configuration" {
+				body = respConfiguration
+			}
+			return &http.Response{
+				StatusCode: http.StatusOK,
+				Header:     jsonHeader,
+				Body:       ioutil.NopCloser(bytes.NewBufferString(body)),
+			}, nil
+		},
+	}
+}
+
+func Test_certManager_Retry(t *testing.T) {
+	unavailable := &StatusError{StatusCode: http.StatusServiceUnavailable}
+	tests := []struct {
+		name         string
+		failures     []error
+		attempts     int
+		wantErr      bool
+		wantRequests int
+	}{
+		{
+			name:         "recovers from 503",
+			failures:     []error{unavailable, unavailable},
+			attempts:     3,
+			wantRequests: 4,
+		},
+		{
+			name:         "recovers from connection reset",
+			failures:     []error{syscall.ECONNRESET},
+			attempts:     3,
+			wantRequests: 3,
+		},
+		{
+			name:         "gives up after attempts",
+			failures:     []error{unavailable, unavailable, unavailable},
+			attempts:     3,
+			wantErr:      true,
+			wantRequests: 3,
+		},
+		{
+			name:         "no retry on 404",
+			failures:     []error{&StatusError{StatusCode: http.StatusNotFound}},
+			attempts:     3,
+			wantErr:      true,
+			wantRequests: 1,
+		},
+		{
+			name:         "no retry by default",
+			failures:     []error{unavailable},
+			attempts:     0,
+			wantErr:      true,
+			wantRequests: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			idp := &flakyIdP{failures: tt.failures}
+			opts := append([]Option{}, testIdP...)
+			if tt.attempts > 0 {
+				opts = append(opts, WithRetry(tt.attempts, time.Millisecond, 5*time.Millisecond))
+			}
+			_, err := NewCertManager("test", idp.client(), opts...).Cert(keycloakKid, "test")
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Cert() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if idp.requests != tt.wantRequests {
+				t.Errorf("requests = %d, want %d", idp.requests, tt.wantRequests)
+			}
+		})
+	}
+}
+
+func Test_certManager_KeySetTTL(t *testing.T) {
+	idp := &flakyIdP{}
+	cm := NewCertManager("test", idp.client(), testIdP...).(certManager)
+	for i := 0; i < 3; i++ {
+		if _, err := cm.Cert(keycloakKid, "test"); err != nil {
+			t.Fatalf("Cert() error = %v", err)
+		}
+	}
+	if keys, err := cm.KeySet(context.Background(), "test"); err != nil || len(keys) != 1 {
+		t.Fatalf("KeySet() = %v, %v", keys, err)
+	}
+	if idp.requests != 2 {
+		t.Errorf("requests = %d, want 2 within the TTL", idp.requests)
+	}
+
+	// Unknown kids only refresh a key set older than the miss interval.
+	if _, err := cm.Cert("unknown", "test"); err == nil {
+		t.Error("Cert() found an unknown kid")
+	}
+	if idp.requests != 2 {
+		t.Errorf("requests = %d after a miss on a fresh key set, want 2", idp.requests)
+	}
+	cm.missInterval = 0
+	_, _ = cm.Cert("unknown", "test")
+	if idp.requests != 3 {
+		t.Errorf("requests = %d after a miss, want 3", idp.requests)
+	}
+	cm.keySetTTL = 0
+	_, _ = cm.KeySet(context.Background(), "test")
+	if idp.requests != 4 {
+		t.Errorf("requests = %d after the TTL, want 4", idp.requests)
+	}
+}
+
+func Test_certManager_SharedRefresh(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		requests int
+	)
+	release := make(chan struct{})
+	client := &HttpClientCustomMock{
+		DoMock: func(req *http.Request) (*http.Response, error) {
+			body := respConfiguration
+			if req.URL.Path != "test/test/.well-known/openid-configuration" {
+				mu.Lock()
+				requests++
+				first := requests == 1
+				mu.Unlock()
+				if !first {
+					<-release
+				}
+				body = respCerts
+			}
+			return &http.Response{
+				StatusCode: http.StatusOK,
+				Header:     jsonHeader,
+				Body:       ioutil.NopCloser(bytes.NewBufferString(body)),
+			}, nil
+		},
+	}
+	cm := NewCertManager("test", client, testIdP...).(certManager)
+	cm.missInterval = 0
+	if _, err := cm.Cert(keycloakKid, "test"); err != nil {
+		t.Fatalf("Cert() error = %v", err)
+	}
+
+	// Unknown kids looked up together refresh the key set once.
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, _ = cm.Cert("unknown", "test")
+		}()
+	}
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	if requests != 2 {
+		t.Errorf("key set requests = %d, want 2", requests)
+	}
+}
+
+func Test_certManager_CircuitBreaker(t *testing.T) {
+	idp := &flakyIdP{}
+	opts := append([]Option{WithCircuitBreaker(2, 50*time.Millisecond), WithDiscoveryTTL(0), WithKeySetTTL(0)}, testIdP...)
+	cm := NewCertManager("test", idp.client(), opts...)
+	if _, err := cm.Cert(keycloakKid, "test"); err != nil {
+		t.Fatalf("Cert() error = %v", err)
+	}
+
+	idp.failures = []error{syscall.ECONNRESET, syscall.ECONNRESET}
+	for i := 0; i < 2; i++ {
+		if _, err := cm.Cert(keycloakKid, "test"); errors.Is(err, ErrIdPUnavailable) {
+			t.Fatalf("Cert() error = %v before the circuit opened", err)
+		}
+	}
+	requests := idp.requests
+	got, err := cm.Cert(keycloakKid, "test")
+	if err != nil || got.Kid != keycloakKid {
+		t.Errorf("Cert() = %v, %v, want cached key while open", got, err)
+	}
+	if _, err = cm.Cert("unknown", "other"); !errors.Is(err, ErrIdPUnavailable) {
+		t.Errorf("Cert() error = %v, wantErr %v", err, ErrIdPUnavailable)
+	}
+	var ue *UnavailableError
+	if !errors.As(err, &ue) || !errors.Is(ue.Err, syscall.ECONNRESET) {
+		t.Errorf("Cert() error = %#v, want UnavailableError wrapping the last failure", err)
+	}
+	if idp.requests != requests {
+		t.Errorf("requests while open = %d, want 0", idp.requests-requests)
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	idp.failures = nil
+	if _, err = cm.Cert(keycloakKid, "test"); err != nil {
+		t.Errorf("Cert() error = %v after cooldown", err)
+	}
+	if idp.requests == requests {
+		t.Error("no trial request after cooldown")
+	}
+}
+
+func Test_WithCircuitBreaker_Defaults(t *testing.T) {
+	tests := []struct {
+		name          string
+		threshold     int
+		cooldown      time.Duration
+		wantThreshold int
+		wantCooldown  time.Duration
+	}{
+		{name: "valid", threshold: 2, cooldown: time.Second, wantThreshold: 2, wantCooldown: time.Second},
+		{name: "zero", wantThreshold: defaultBreakerThreshold, wantCooldown: defaultBreakerCooldown},
+		{name: "negative", threshold: -1, cooldown: -time.Second, wantThreshold: defaultBreakerThreshold, wantCooldown: defaultBreakerCooldown},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cb := NewCertManager("test", (&flakyIdP{}).client(), WithCircuitBreaker(tt.threshold, tt.cooldown)).(certManager).breaker
+			if cb.threshold != tt.wantThreshold || cb.cooldown != tt.wantCooldown {
+				t.Errorf("WithCircuitBreaker() = %d, %v, want %d, %v", cb.threshold, cb.cooldown, tt.wantThreshold, tt.wantCooldown)
+			}
+		})
+	}
+}
+
+func Test_certManager_Recorder(t *testing.T) {
+	idp := &flakyIdP{failures: []error{&StatusError{StatusCode: http.StatusBadGateway}}}
+	var (
+		fetches []string
+		keys    int
+	)
+	recorder := metrics.RecorderCustomMock{
+		DocumentFetchedMock: func(realm, document string, statusCode int, elapsed time.Duration) {
+			fetches = append(fetches, fmt.Sprintf("%s/%s/%d", realm, document, statusCode))
+		},
+		CachedKeysMock: func(realm string, n int) {
+			keys = n
+		},
+	}
+	opts := append([]Option{WithRecorder(recorder), WithRetry(2, time.Millisecond, time.Millisecond)}, testIdP...)
+	if _, err := NewCertManager("test", idp.client(), opts...).Cert(keycloakKid, "test"); err != nil {
+		t.Fatalf("Cert() error = %v", err)
+	}
+	want := []string{"test/configuration/502", "test/configuration/200", "test/keys/200"}
+	if !reflect.DeepEqual(fetches, want) {
+		t.Errorf("fetches = %v, want %v", fetches, want)
+	}
+	if keys != 1 {
+		t.Errorf("cached keys = %d, want 1", keys)
+	}
+}
@@ -0,0 +1,229 @@
+package cert
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log/slog"
+	"math/big"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/marcosgmgm/openid-decode-token/internal/instrument"
+)
+
+// staticManager serves a fixed key set, for deployments that cannot reach
+// the identity provider or want to pin its keys. The realm is ignored.
+type staticManager struct {
+	mu     sync.RWMutex
+	keys   []Cert
+	policy keyPolicy
+	logger *slog.Logger
+}
+
+// StaticOption customizes the managers over pinned keys.
+type StaticOption func(*staticManager)
+
+// WithStaticLogger logs the key files NewFileManager fails to reload at warn
+// level.
+func WithStaticLogger(l *slog.Logger) StaticOption {
+	return func(sm *staticManager) {
+		sm.logger = l
+	}
+}
+
+// NewStaticManager returns a Manager over the given keys, held to the
+// default key policy unless WithStaticKeyPolicy says otherwise.
+func NewStaticManager(keys []Cert, opts ...StaticOption) Manager {
+	return newStaticManager(keys, opts...)
+}
+
+func newStaticManager(keys []Cert, opts ...StaticOption) *staticManager {
+	sm := &staticManager{keys: keys, policy: defaultKeyPolicy(), logger: instrument.DiscardLogger}
+	for _, opt := range opts {
+		opt(sm)
+	}
+	return sm
+}
+
+// NewJWKSManager returns a Manager over the JWKS document read from r.
+func NewJWKSManager(r io.Reader, opts ...StaticOption) (Manager, error) {
+	keys, err := decodeKeySet(r)
+	if err != nil {
+		return nil, err
+	}
+	return newStaticManager(keys, opts...), nil
+}
+
+// NewJWKSManagerFromBytes returns a Manager over a JWKS document, typically
+// one embedded in the binary with go:embed.
+func NewJWKSManagerFromBytes(jwks []byte, opts ...StaticOption) (Manager, error) {
+	return NewJWKSManager(bytes.NewReader(jwks), opts...)
+}
+
+// NewPEMManager returns a Manager holding a single RSA key published under
+// kid. The PEM block may be a PKIX or PKCS#1 public key or a certificate.
+func NewPEMManager(kid string, pemBytes []byte, opts ...StaticOption) (Manager, error) {
+	c, err := pemCert(kid, pemBytes)
+	if err != nil {
+		return nil, err
+	}
+	return newStaticManager([]Cert{*c}, opts...), nil
+}
+
+// NewFileManager returns a Manager over the JWKS file at path. When reload is
+// positive the file is checked at that interval until ctx is done, and a
+// changed file replaces the key set in one step. A file that cannot be read
+// or parsed keeps the previous keys in place and is logged, see
+// WithStaticLogger.
+func NewFileManager(ctx context.Context, path string, reload time.Duration, opts ...StaticOption) (Manager, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	keys, err := readKeySetFile(path)
+	if err != nil {
+		return nil, err
+	}
+	sm := newStaticManager(keys, opts...)
+	if reload > 0 {
+		go sm.watch(ctx, path, reload, info)
+	}
+	return sm, nil
+}
+
+func (sm *staticManager) Cert(kid, realm string) (*Cert, error) {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+	return findCert(sm.keys, kid)
+}
+
+func (sm *staticManager) KeySet(ctx context.Context, realm string) ([]Cert, error) {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+	return append([]Cert(nil), sm.keys...), nil
+}
+
+func (sm *staticManager) PublicKey(cert *Cert) (*rsa.PublicKey, error) {
+	key, err := rsaPublicKey(cert)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = sm.policy.check(key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+func (sm *staticManager) Key(cert *Cert) (key crypto.PublicKey, err error) {
+	switch cert.Kty {
+	case "RSA":
+		key, err = rsaPublicKey(cert)
+	case "EC":
+		key, err = ecPublicKey(cert)
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrUnsupportedKeyType, cert.Kty)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if _, err = sm.policy.check(key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+func (sm *staticManager) watch(ctx context.Context, path string, reload time.Duration, last os.FileInfo) {
+	ticker := time.NewTicker(reload)
+	defer ticker.Stop()
+	// failing is set while the file cannot be found, to log it once.
+	failing := false
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			if !failing {
+				sm.logger.Warn("key file reload failed, keeping the previous keys", "path", path, "error", err)
+			}
+			failing = true
+			continue
+		}
+		failing = false
+		if info.ModTime().Equal(last.ModTime()) && info.Size() == last.Size() {
+			continue
+		}
+		// A file that fails to parse is only read again once it changes.
+		last = info
+		keys, err := readKeySetFile(path)
+		if err != nil {
+			sm.logger.Warn("key file reload failed, keeping the previous keys", "path", path, "error", err)
+			continue
+		}
+		sm.mu.Lock()
+		sm.keys = keys
+		sm.mu.Unlock()
+	}
+}
+
+func readKeySetFile(path string) ([]Cert, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return decodeKeySet(bytes.NewReader(b))
+}
+
+func pemCert(kid string, pemBytes []byte) (*Cert, error) {
+	block, _ := pem.Decode(pemBytes)
+	if block == nil {
+		return nil, errors.New("no PEM data found")
+	}
+	var (
+		key interface{}
+		x5c []string
+		err error
+	)
+	switch block.Type {
+	case "PUBLIC KEY":
+		key, err = x509.ParsePKIXPublicKey(block.Bytes)
+	case "RSA PUBLIC KEY":
+		key, err = x509.ParsePKCS1PublicKey(block.Bytes)
+	case "CERTIFICATE":
+		var c *x509.Certificate
+		c, err = x509.ParseCertificate(block.Bytes)
+		if err == nil {
+			key = c.PublicKey
+			x5c = []string{base64.StdEncoding.EncodeToString(block.Bytes)}
+		}
+	default:
+		return nil, errors.New("unsupported PEM block: " + block.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+	rsaKey, ok := key.(*rsa.PublicKey)
+	if !ok {
+		return nil, errors.New("PEM does not hold an RSA public key")
+	}
+	return &Cert{
+		Kty: "RSA",
+		Use: "sig",
+		Kid: kid,
+		N:   base64.RawURLEncoding.EncodeToString(rsaKey.N.Bytes()),
+		E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(rsaKey.E)).Bytes()),
+		X5c: x5c,
+	}, nil
+}
@@ -0,0 +1,235 @@
+package cert
+
+import (
+	"bytes"
+	"context"
+	"crypto/elliptic"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"io/ioutil"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+const keycloakKid = "1h_MHweQR-g8osNYJvhd-FZ4s2lJ52PRm0G68jsuLPc"
+
+func Test_staticManager_Cert(t *testing.T) {
+	_, pub, _ := generateKeys()
+	pkix, _ := x509.MarshalPKIXPublicKey(pub)
+	pkixPEM := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pkix})
+	pkcs1PEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PUBLIC KEY", Bytes: x509.MarshalPKCS1PublicKey(pub)})
+
+	jwks, err := NewJWKSManager(strings.NewReader(respCerts))
+	if err != nil {
+		t.Fatal(err)
+	}
+	pkixManager, err := NewPEMManager("pinned", pkixPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pkcs1Manager, err := NewPEMManager("pinned", pkcs1PEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name    string
+		manager Manager
+		kid     string
+		wantErr bool
+	}{
+		{name: "jwks", manager: jwks, kid: keycloakKid},
+		{name: "jwks unknown kid", manager: jwks, kid: "unknown", wantErr: true},
+		{name: "pkix pem", manager: pkixManager, kid: "pinned"},
+		{name: "pkcs1 pem", manager: pkcs1Manager, kid: "pinned"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := tt.manager.Cert(tt.kid, "any realm")
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Cert() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErr {
+				return
+			}
+			if _, err = tt.manager.PublicKey(c); err != nil {
+				t.Errorf("PublicKey() error = %v", err)
+			}
+		})
+	}
+	got, _ := pkixManager.Cert("pinned", "")
+	key, _ := pkixManager.PublicKey(got)
+	if key.E != pub.E || key.N.Cmp(pub.N) != 0 {
+		t.Errorf("PublicKey() got = %v, want %v", key, pub)
+	}
+}
+
+func Test_NewPEMManager_Invalid(t *testing.T) {
+	if _, err := NewPEMManager("kid", []byte("not a pem")); err == nil {
+		t.Error("NewPEMManager() expected error for invalid PEM")
+	}
+	block := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: []byte{1}})
+	if _, err := NewPEMManager("kid", block); err == nil {
+		t.Error("NewPEMManager() expected error for unsupported block")
+	}
+}
+
+func Test_NewFileManager_Reload(t *testing.T) {
+	dir, err := ioutil.TempDir("", "jwks")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "jwks.json")
+	if err = ioutil.WriteFile(path, []byte(`{"keys":[{"kid":"old","kty":"RSA","n":"AQAB","e":"AQAB"}]}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	fm, err := NewFileManager(ctx, path, 10*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = fm.Cert("old", ""); err != nil {
+		t.Fatalf("Cert() error = %v", err)
+	}
+
+	if err = ioutil.WriteFile(path, []byte(respCerts), 0600); err != nil {
+		t.Fatal(err)
+	}
+	future := time.Now().Add(time.Minute)
+	os.Chtimes(path, future, future)
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		if _, err = fm.Cert(keycloakKid, ""); err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("key set was not reloaded: %v", err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if _, err = fm.Cert("old", ""); err == nil {
+		t.Error("Cert() old key still served after reload")
+	}
+}
+
+func Test_NewFileManager_ReloadFailure(t *testing.T) {
+	dir, err := ioutil.TempDir("", "jwks")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "jwks.json")
+	if err = ioutil.WriteFile(path, []byte(respCerts), 0600); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	logs := &syncBuffer{}
+	fm, err := NewFileManager(ctx, path, 10*time.Millisecond, WithStaticLogger(slog.New(slog.NewJSONHandler(logs, nil))))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = ioutil.WriteFile(path, []byte(`{"keys":`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	future := time.Now().Add(time.Minute)
+	os.Chtimes(path, future, future)
+	deadline := time.Now().Add(2 * time.Second)
+	for !strings.Contains(logs.String(), "key file reload failed") {
+		if time.Now().After(deadline) {
+			t.Fatal("corrupt key file was not logged")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if _, err = fm.Cert(keycloakKid, ""); err != nil {
+		t.Errorf("Cert() error = %v, want the previous keys", err)
+	}
+	if n := strings.Count(logs.String(), "key file reload failed"); n != 1 {
+		t.Errorf("reload failures logged %d times for one change, want 1", n)
+	}
+}
+
+// syncBuffer is a bytes.Buffer safe for a logger writing from another
+// goroutine.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func Test_staticManager_Options(t *testing.T) {
+	weak := *rsaJWK(t, 1024)
+	if _, err := NewStaticManager([]Cert{weak}).PublicKey(&weak); !errors.Is(err, ErrKeyRejected) {
+		t.Errorf("PublicKey() error = %v, want ErrKeyRejected", err)
+	}
+	if _, err := NewStaticManager([]Cert{weak}, WithStaticKeyPolicy(1024)).PublicKey(&weak); err != nil {
+		t.Errorf("PublicKey() error = %v with a lenient policy", err)
+	}
+}
+
+func Test_staticManager_KeySet(t *testing.T) {
+	m, err := NewJWKSManagerFromBytes([]byte(respCerts))
+	if err != nil {
+		t.Fatalf("NewJWKSManagerFromBytes() error = %v", err)
+	}
+	keys, err := m.(KeySetManager).KeySet(context.Background(), "ignored")
+	if err != nil || len(keys) != 1 || keys[0].Kid != keycloakKid {
+		t.Fatalf("KeySet() = %v, %v", keys, err)
+	}
+	keys[0].Kid = "changed"
+	if _, err = m.Cert(keycloakKid, "ignored"); err != nil {
+		t.Errorf("KeySet() shares its slice with the manager: %v", err)
+	}
+}
+
+func Test_staticManager_KeyPolicy(t *testing.T) {
+	weak := rsaJWK(t, 1024)
+	jwks, _ := json.Marshal(map[string][]publishedKey{"keys": {publishedKey(*weak)}})
+	strict, err := NewJWKSManagerFromBytes(jwks)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lenient, err := NewJWKSManagerFromBytes(jwks, WithStaticKeyPolicy(1024))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = strict.PublicKey(weak); !errors.Is(err, ErrKeyRejected) {
+		t.Errorf("PublicKey() error = %v, want ErrKeyRejected", err)
+	}
+	if _, err = strict.(KeyManager).Key(weak); !errors.Is(err, ErrKeyRejected) {
+		t.Errorf("Key() error = %v, want ErrKeyRejected", err)
+	}
+	if _, err = lenient.(KeyManager).Key(weak); err != nil {
+		t.Errorf("Key() error = %v with a lenient policy", err)
+	}
+	p384 := ecJWK(t, elliptic.P384())
+	jwks, _ = json.Marshal(map[string][]publishedKey{"keys": {publishedKey(*p384)}})
+	p256Only, err := NewJWKSManagerFromBytes(jwks, WithStaticKeyPolicy(2048, "P-256"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = p256Only.(KeyManager).Key(p384); !errors.Is(err, ErrKeyRejected) {
+		t.Errorf("Key() error = %v, want ErrKeyRejected for P-384", err)
+	}
+}
@@ -0,0 +1,42 @@
+package cert
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+var ErrUnsupportedKeyType = errors.New("unsupported key type")
+
+// Thumbprint returns the RFC 7638 JWK thumbprint of the key: the base64url
+// encoded SHA-256 digest of its required members in lexicographic order.
+func (c Cert) Thumbprint() (string, error) {
+	var members []string
+	switch c.Kty {
+	case "RSA":
+		members = []string{"e", c.E, "kty", c.Kty, "n", c.N}
+	case "EC":
+		members = []string{"crv", c.Crv, "kty", c.Kty, "x", c.X, "y", c.Y}
+	case "OKP":
+		members = []string{"crv", c.Crv, "kty", c.Kty, "x", c.X}
+	default:
+		return "", fmt.Errorf("%w: %q", ErrUnsupportedKeyType, c.Kty)
+	}
+	// Marshalling a map sorts its keys and leaves no whitespace, which is
+	// the canonical form RFC 7638 hashes.
+	m := make(map[string]string, len(members)/2)
+	for i := 0; i < len(members); i += 2 {
+		if len(members[i+1]) == 0 {
+			return "", fmt.Errorf("%w: %s key without %q", ErrUnsupportedKeyType, c.Kty, members[i])
+		}
+		m[members[i]] = members[i+1]
+	}
+	b, err := json.Marshal(m)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(b)
+	return base64.RawURLEncoding.EncodeToString(sum[:]), nil
+}
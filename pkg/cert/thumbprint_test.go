@@ -0,0 +1,59 @@
+package cert
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestCert_Thumbprint(t *testing.T) {
+	tests := []struct {
+		name    string
+		cert    Cert
+		want    string
+		wantErr error
+	}{
+		{
+			name: "RFC 7638 example",
+			cert: Cert{
+				Kty: "RSA",
+				Kid: "2011-04-29",
+				N:   "0vx7agoebGcQSuuPiLJXZptN9nndrQmbXEps2aiAFbWhM78LhWx4cbbfAAtVT86zwu1RK7aPFFxuhDR1L6tSoc_BJECPebWKRXjBZCiFV4n3oknjhMstn64tZ_2W-5JsGY4Hc5n9yBXArwl93lqt7_RN5w6Cf0h4QyQ5v-65YGjQR0_FDW2QvzqY368QQMicAtaSqzs8KJZgnYb9c7d0zgdAZHzu6qMQvRL5hajrn1n91CbOpbISD08qNLyrdkt-bFTWhAI4vMQFh6WeZu0fM4lFd2NcRwr3XPksINHaQ-G_xBniIqbw0Ls1jF44-csFCur-kEgU8awapJzKnqDKgw",
+				E:   "AQAB",
+			},
+			want: "NzbLsXh8uDCcd-6MNwXF4W_7noWXFZAfHkxZsRGC9Xs",
+		},
+		{
+			name: "members outside the thumbprint are ignored",
+			cert: Cert{
+				Kty: "RSA",
+				Kid: "other",
+				Use: "sig",
+				Alg: "RS256",
+				N:   "0vx7agoebGcQSuuPiLJXZptN9nndrQmbXEps2aiAFbWhM78LhWx4cbbfAAtVT86zwu1RK7aPFFxuhDR1L6tSoc_BJECPebWKRXjBZCiFV4n3oknjhMstn64tZ_2W-5JsGY4Hc5n9yBXArwl93lqt7_RN5w6Cf0h4QyQ5v-65YGjQR0_FDW2QvzqY368QQMicAtaSqzs8KJZgnYb9c7d0zgdAZHzu6qMQvRL5hajrn1n91CbOpbISD08qNLyrdkt-bFTWhAI4vMQFh6WeZu0fM4lFd2NcRwr3XPksINHaQ-G_xBniIqbw0Ls1jF44-csFCur-kEgU8awapJzKnqDKgw",
+				E:   "AQAB",
+			},
+			want: "NzbLsXh8uDCcd-6MNwXF4W_7noWXFZAfHkxZsRGC9Xs",
+		},
+		{
+			name:    "missing member",
+			cert:    Cert{Kty: "EC", Crv: "P-256", X: "x"},
+			wantErr: ErrUnsupportedKeyType,
+		},
+		{
+			name:    "symmetric key",
+			cert:    Cert{Kty: "oct"},
+			wantErr: ErrUnsupportedKeyType,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.cert.Thumbprint()
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Thumbprint() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("Thumbprint() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,37 @@
+package cert
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const instrumentationName = "github.com/marcosgmgm/openid-decode-token/pkg/cert"
+
+// Span attributes.
+const (
+	attrRealm    = attribute.Key("openid.realm")
+	attrKid      = attribute.Key("openid.kid")
+	attrCacheHit = attribute.Key("openid.cache_hit")
+	attrDocument = attribute.Key("openid.document")
+	attrURL      = attribute.Key("url.full")
+	attrStatus   = attribute.Key("http.response.status_code")
+	attrAttempts = attribute.Key("openid.attempts")
+)
+
+// ContextManager is implemented by managers whose key lookups honour a
+// context, such as the one returned by NewCertManager. The decoder uses it
+// to parent the key lookup spans to the decode span.
+type ContextManager interface {
+	CertContext(ctx context.Context, kid, realm string) (*Cert, error)
+}
+
+// WithTracerProvider records a span for every key lookup, discovery and
+// request to the identity provider. The trace context is injected in the
+// requests with the global propagator, see otel.SetTextMapPropagator.
+func WithTracerProvider(tp trace.TracerProvider) Option {
+	return func(cm *certManager) {
+		cm.tracer = tp.Tracer(instrumentationName)
+	}
+}
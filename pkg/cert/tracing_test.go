@@ -0,0 +1,72 @@
+package cert
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func Test_certManager_Tracing(t *testing.T) {
+	prev := otel.GetTextMapPropagator()
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	defer otel.SetTextMapPropagator(prev)
+
+	spans := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(spans))
+	idp := &flakyIdP{failures: []error{&StatusError{StatusCode: http.StatusServiceUnavailable}}}
+	var traceparents []string
+	client := idp.client().(*HttpClientCustomMock)
+	do := client.DoMock
+	client.DoMock = func(req *http.Request) (*http.Response, error) {
+		traceparents = append(traceparents, req.Header.Get("traceparent"))
+		return do(req)
+	}
+	opts := append([]Option{WithTracerProvider(tp), WithRetry(2, 0, 0)}, testIdP...)
+	cm := NewCertManager("test", client, opts...).(ContextManager)
+
+	ctx, parent := tp.Tracer("test").Start(context.Background(), "parent")
+	if _, err := cm.CertContext(ctx, keycloakKid, "test"); err != nil {
+		t.Fatalf("CertContext() error = %v", err)
+	}
+	parent.End()
+
+	byName := make(map[string]sdktrace.ReadOnlySpan)
+	for _, s := range spans.Ended() {
+		byName[s.Name()] = s
+	}
+	for child, parentName := range map[string]string{
+		"cert.Cert":                "parent",
+		"cert.Discover":            "cert.Cert",
+		"cert.fetch configuration": "cert.Discover",
+		"cert.fetch keys":          "cert.Cert",
+	} {
+		s, ok := byName[child]
+		if !ok {
+			t.Errorf("no %q span", child)
+			continue
+		}
+		if s.Parent().SpanID() != byName[parentName].SpanContext().SpanID() {
+			t.Errorf("%q span is not a child of %q", child, parentName)
+		}
+	}
+	attrs := make(map[string]string)
+	for _, kv := range byName["cert.fetch configuration"].Attributes() {
+		attrs[string(kv.Key)] = kv.Value.Emit()
+	}
+	if attrs["http.response.status_code"] != "200" || attrs["openid.attempts"] != "2" {
+		t.Errorf("fetch attributes = %v", attrs)
+	}
+	if len(traceparents) != 3 {
+		t.Fatalf("requests = %d, want 3", len(traceparents))
+	}
+	for _, tp := range traceparents {
+		if len(tp) == 0 {
+			t.Error("request without traceparent header")
+		}
+	}
+}
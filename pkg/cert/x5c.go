@@ -0,0 +1,180 @@
+package cert
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+var (
+	ErrMissingX5c        = errors.New("key has no x5c certificate chain")
+	ErrX5cKeyMismatch    = errors.New("x5c leaf certificate does not match the published key")
+	ErrX5tMismatch       = errors.New("x5t does not match x5c leaf certificate")
+	ErrX5tS256Mismatch   = errors.New("x5t#S256 does not match x5c leaf certificate")
+	ErrX5cUnsupportedKey = errors.New("x5c leaf certificate has no RSA or EC public key")
+)
+
+// WithX5cValidation makes the manager derive keys from the x5c leaf
+// certificate instead of n/e or x/y. The chain must verify against roots and
+// be valid at the current time, the leaf key must equal the published one
+// when it is there and the x5t/x5t#S256 thumbprints, when present, must
+// match. Chains are verified once per key set load.
+func WithX5cValidation(roots *x509.CertPool) Option {
+	return func(cm *certManager) {
+		cm.x5cRoots = roots
+	}
+}
+
+// x5cCache holds the keys of the chains verified on the last key set load
+// of each realm, until the first certificate of the chain expires.
+type x5cCache struct {
+	mu     sync.RWMutex
+	realms map[string]map[string]x5cEntry
+}
+
+type x5cEntry struct {
+	key     crypto.PublicKey
+	expires time.Time
+}
+
+func newX5cCache() *x5cCache {
+	return &x5cCache{realms: make(map[string]map[string]x5cEntry)}
+}
+
+// load replaces the chains of realm by the ones of keys that verify.
+func (xc *x5cCache) load(realm string, keys []Cert, roots *x509.CertPool) {
+	entries := make(map[string]x5cEntry, len(keys))
+	for i := range keys {
+		if len(keys[i].X5c) == 0 {
+			continue
+		}
+		key, expires, err := x5cPublicKey(&keys[i], roots)
+		if err == nil {
+			entries[x5cCacheKey(&keys[i])] = x5cEntry{key: key, expires: expires}
+		}
+	}
+	xc.mu.Lock()
+	defer xc.mu.Unlock()
+	xc.realms[realm] = entries
+}
+
+func (xc *x5cCache) lookup(cert *Cert) (crypto.PublicKey, bool) {
+	id := x5cCacheKey(cert)
+	xc.mu.RLock()
+	defer xc.mu.RUnlock()
+	for _, entries := range xc.realms {
+		if e, ok := entries[id]; ok && time.Now().Before(e.expires) {
+			return e.key, true
+		}
+	}
+	return nil, false
+}
+
+// x5cCacheKey identifies cert by all its members, so that a chain verified
+// for one key is never reused for a key that differs in any of them.
+func x5cCacheKey(cert *Cert) string {
+	b, _ := json.Marshal(cert)
+	return string(b)
+}
+
+// x5cPublicKey verifies the x5c chain of cert and returns the key of its
+// leaf certificate with the time the chain stops being valid.
+func x5cPublicKey(cert *Cert, roots *x509.CertPool) (crypto.PublicKey, time.Time, error) {
+	if len(cert.X5c) == 0 {
+		return nil, time.Time{}, ErrMissingX5c
+	}
+	chain := make([]*x509.Certificate, 0, len(cert.X5c))
+	for i, enc := range cert.X5c {
+		der, err := base64.StdEncoding.DecodeString(enc)
+		if err != nil {
+			return nil, time.Time{}, fmt.Errorf("x5c[%d]: %w", i, err)
+		}
+		c, err := x509.ParseCertificate(der)
+		if err != nil {
+			return nil, time.Time{}, fmt.Errorf("x5c[%d]: %w", i, err)
+		}
+		chain = append(chain, c)
+	}
+	leaf := chain[0]
+	intermediates := x509.NewCertPool()
+	for _, c := range chain[1:] {
+		intermediates.AddCert(c)
+	}
+	chains, err := leaf.Verify(x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	})
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	if len(cert.X5t) > 0 {
+		sum := sha1.Sum(leaf.Raw)
+		if base64.RawURLEncoding.EncodeToString(sum[:]) != cert.X5t {
+			return nil, time.Time{}, ErrX5tMismatch
+		}
+	}
+	if len(cert.X5tS256) > 0 {
+		sum := sha256.Sum256(leaf.Raw)
+		if base64.RawURLEncoding.EncodeToString(sum[:]) != cert.X5tS256 {
+			return nil, time.Time{}, ErrX5tS256Mismatch
+		}
+	}
+	if err = matchLeafKey(cert, leaf.PublicKey); err != nil {
+		return nil, time.Time{}, err
+	}
+	expires := leaf.NotAfter
+	for _, c := range chains[0] {
+		if c.NotAfter.Before(expires) {
+			expires = c.NotAfter
+		}
+	}
+	return leaf.PublicKey, expires, nil
+}
+
+// matchLeafKey checks that the leaf key is an RSA or EC key equal to the one
+// published in cert, when it is.
+func matchLeafKey(cert *Cert, leafKey crypto.PublicKey) error {
+	switch k := leafKey.(type) {
+	case *rsa.PublicKey:
+		if len(cert.Kty) > 0 && cert.Kty != "RSA" {
+			return fmt.Errorf("%w: RSA certificate for a %s key", ErrX5cKeyMismatch, cert.Kty)
+		}
+		if len(cert.N) == 0 && len(cert.E) == 0 {
+			return nil
+		}
+		jwkKey, err := rsaPublicKey(cert)
+		if err != nil {
+			return err
+		}
+		if !k.Equal(jwkKey) {
+			return ErrX5cKeyMismatch
+		}
+	case *ecdsa.PublicKey:
+		if len(cert.Kty) > 0 && cert.Kty != "EC" {
+			return fmt.Errorf("%w: EC certificate for a %s key", ErrX5cKeyMismatch, cert.Kty)
+		}
+		if len(cert.X) == 0 && len(cert.Y) == 0 {
+			return nil
+		}
+		jwkKey, err := ecPublicKey(cert)
+		if err != nil {
+			return err
+		}
+		if !k.Equal(jwkKey) {
+			return ErrX5cKeyMismatch
+		}
+	default:
+		return fmt.Errorf("%w: %T", ErrX5cUnsupportedKey, leafKey)
+	}
+	return nil
+}
@@ -0,0 +1,147 @@
+package cert
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func Test_certManager_PublicKeyX5c(t *testing.T) {
+	var kr struct {
+		Keys []Cert `json:"keys"`
+	}
+	if err := json.Unmarshal([]byte(respCerts), &kr); err != nil {
+		t.Fatal(err)
+	}
+	keycloak := kr.Keys[0]
+	der, _ := base64.StdEncoding.DecodeString(keycloak.X5c[0])
+	leaf, _ := x509.ParseCertificate(der)
+	trusted := x509.NewCertPool()
+	trusted.AddCert(leaf)
+
+	withoutNE := keycloak
+	withoutNE.N, withoutNE.E = "", ""
+	otherN := keycloak
+	_, otherKey, _ := generateKeys()
+	otherN.N = base64.RawURLEncoding.EncodeToString(otherKey.N.Bytes())
+	otherX5t := keycloak
+	otherX5t.X5t = "AAAA"
+	otherX5tS256 := keycloak
+	otherX5tS256.X5tS256 = "AAAA"
+	withoutX5c := keycloak
+	withoutX5c.X5c = nil
+
+	tests := []struct {
+		name    string
+		roots   *x509.CertPool
+		cert    Cert
+		want    *rsa.PublicKey
+		wantErr bool
+		isErr   error
+	}{
+		{name: "success", roots: trusted, cert: keycloak, want: leaf.PublicKey.(*rsa.PublicKey)},
+		{name: "success without n and e", roots: trusted, cert: withoutNE, want: leaf.PublicKey.(*rsa.PublicKey)},
+		{name: "untrusted chain", roots: x509.NewCertPool(), cert: keycloak, wantErr: true},
+		{name: "n does not match", roots: trusted, cert: otherN, wantErr: true, isErr: ErrX5cKeyMismatch},
+		{name: "x5t does not match", roots: trusted, cert: otherX5t, wantErr: true, isErr: ErrX5tMismatch},
+		{name: "x5t#S256 does not match", roots: trusted, cert: otherX5tS256, wantErr: true, isErr: ErrX5tS256Mismatch},
+		{name: "missing x5c", roots: trusted, cert: withoutX5c, wantErr: true, isErr: ErrMissingX5c},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cm := NewCertManager("test", http.DefaultClient, WithX5cValidation(tt.roots))
+			got, err := cm.PublicKey(&tt.cert)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("PublicKey() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErr {
+				if tt.isErr != nil && !errors.Is(err, tt.isErr) {
+					t.Errorf("PublicKey() error = %v, want %v", err, tt.isErr)
+				}
+				return
+			}
+			if got.E != tt.want.E || got.N.Cmp(tt.want.N) != 0 {
+				t.Errorf("PublicKey() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// selfSigned returns a self-signed certificate for the key of signer, valid
+// for an hour.
+func selfSigned(t *testing.T, signer crypto.Signer) *x509.Certificate {
+	t.Helper()
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test"},
+		NotBefore:             time.Now().Add(-time.Minute),
+		NotAfter:              time.Now().Add(time.Hour),
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, signer.Public(), signer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func Test_certManager_KeyX5cEC(t *testing.T) {
+	pk, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	leaf := selfSigned(t, pk)
+	trusted := x509.NewCertPool()
+	trusted.AddCert(leaf)
+	size := (elliptic.P256().Params().BitSize + 7) / 8
+	ec := Cert{
+		Kty: "EC",
+		Kid: "ec",
+		Crv: "P-256",
+		X:   base64.RawURLEncoding.EncodeToString(pk.X.FillBytes(make([]byte, size))),
+		Y:   base64.RawURLEncoding.EncodeToString(pk.Y.FillBytes(make([]byte, size))),
+		X5c: []string{base64.StdEncoding.EncodeToString(leaf.Raw)},
+	}
+	other := ec
+	otherKey := ecJWK(t, elliptic.P256())
+	other.X, other.Y = otherKey.X, otherKey.Y
+	asRSA := ec
+	asRSA.Kty = "RSA"
+
+	cm := NewCertManager("test", http.DefaultClient, WithX5cValidation(trusted)).(certManager)
+	key, err := cm.Key(&ec)
+	if err != nil || !pk.PublicKey.Equal(key) {
+		t.Fatalf("Key() = %v, %v", key, err)
+	}
+	for _, c := range []Cert{other, asRSA} {
+		if _, err = cm.Key(&c); !errors.Is(err, ErrX5cKeyMismatch) {
+			t.Errorf("Key(%s) error = %v, want %v", c.Kty, err, ErrX5cKeyMismatch)
+		}
+	}
+
+	// Chains verified on a key set load are not verified again.
+	cm.x5cVerified.load("test", []Cert{ec}, trusted)
+	cm.x5cRoots = x509.NewCertPool()
+	if _, err = cm.Key(&ec); err != nil {
+		t.Errorf("Key() error = %v for a chain verified on load", err)
+	}
+	unloaded := ec
+	unloaded.Kid = "unloaded"
+	if _, err = cm.Key(&unloaded); err == nil {
+		t.Error("Key() accepted a chain that does not verify")
+	}
+}
@@ -0,0 +1,61 @@
+package decoder
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+var (
+	ErrMissingPeerCertificate = errors.New("no peer certificate")
+	ErrMissingConfirmation    = errors.New("token has no x5t#S256 confirmation")
+	ErrCertificateMismatch    = errors.New("peer certificate does not match token confirmation")
+)
+
+// CertificateThumbprint returns the base64url encoded SHA-256 thumbprint of
+// the DER certificate, as used by the cnf "x5t#S256" member (RFC 8705).
+func CertificateThumbprint(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.Raw)
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// VerifyCertificateBinding checks that a decoded token is bound to the
+// certificate the client presented on the mutual TLS connection. The peer
+// certificate is usually r.TLS.PeerCertificates[0] for HTTP servers or the
+// first certificate of credentials.TLSInfo for gRPC.
+func VerifyCertificateBinding(token *jwt.Token, peer *x509.Certificate) error {
+	if peer == nil {
+		return ErrMissingPeerCertificate
+	}
+	var c struct {
+		Cnf Confirmation `json:"cnf"`
+	}
+	if err := payloadClaims(token.Raw, &c); err != nil {
+		return err
+	}
+	if len(c.Cnf.X5tS256) == 0 {
+		return ErrMissingConfirmation
+	}
+	thumbprint := CertificateThumbprint(peer)
+	if subtle.ConstantTimeCompare([]byte(thumbprint), []byte(c.Cnf.X5tS256)) != 1 {
+		return ErrCertificateMismatch
+	}
+	return nil
+}
+
+// DecodeCertificateBoundToken decodes the token with d and rejects it unless
+// its confirmation claim matches the peer certificate.
+func DecodeCertificateBoundToken(d Decoder, token, realm string, claims jwt.Claims, peer *x509.Certificate) (*jwt.Token, error) {
+	t, err := d.DecodeAccessTokenClaims(token, realm, claims)
+	if err != nil {
+		return nil, err
+	}
+	if err = VerifyCertificateBinding(t, peer); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
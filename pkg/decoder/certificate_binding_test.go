@@ -0,0 +1,104 @@
+package decoder
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/marcosgmgm/openid-decode-token/pkg/cert"
+)
+
+func Test_DecodeCertificateBoundToken(t *testing.T) {
+	pk, pub, _ := generateKeys()
+	peer := generateCertificate(pk, "client")
+	other := generateCertificate(pk, "other")
+	manager := cert.ManagerCustomMock{
+		CertMock: func(kid, realm string) (*cert.Cert, error) {
+			return &cert.Cert{Kid: kid}, nil
+		},
+		PublicKeyMock: func(cert *cert.Cert) (*rsa.PublicKey, error) {
+			return pub, nil
+		},
+	}
+	boundToken := generateCertificateBoundToken(pk, CertificateThumbprint(peer))
+	tests := []struct {
+		name    string
+		token   string
+		peer    *x509.Certificate
+		wantErr error
+	}{
+		{
+			name:    "success",
+			token:   boundToken,
+			peer:    peer,
+			wantErr: nil,
+		},
+		{
+			name:    "certificate mismatch",
+			token:   boundToken,
+			peer:    other,
+			wantErr: ErrCertificateMismatch,
+		},
+		{
+			name:    "no peer certificate",
+			token:   boundToken,
+			peer:    nil,
+			wantErr: ErrMissingPeerCertificate,
+		},
+		{
+			name:    "token without confirmation",
+			token:   generateToken(pk, "Can be anything", time.Minute),
+			peer:    peer,
+			wantErr: ErrMissingConfirmation,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := NewJwtDecoder(manager)
+			got, err := DecodeCertificateBoundToken(d, tt.token, "test", jwt.MapClaims{}, tt.peer)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("DecodeCertificateBoundToken() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if err == nil && got.Raw != tt.token {
+				t.Errorf("DecodeCertificateBoundToken() got = %v, want %v", got.Raw, tt.token)
+			}
+		})
+	}
+}
+
+func generateCertificate(pk *rsa.PrivateKey, cn string) *x509.Certificate {
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, _ := x509.CreateCertificate(rand.Reader, template, template, &pk.PublicKey, pk)
+	c, _ := x509.ParseCertificate(der)
+	return c
+}
+
+func generateCertificateBoundToken(pk *rsa.PrivateKey, thumbprint string) string {
+	now := time.Now().UTC()
+	claims := make(jwt.MapClaims)
+	claims["exp"] = now.Add(time.Minute).Unix()
+	claims["cnf"] = map[string]interface{}{"x5t#S256": thumbprint}
+	token := &jwt.Token{
+		Header: map[string]interface{}{
+			"typ": "JWT",
+			"alg": jwt.SigningMethodRS256.Alg(),
+			"kid": "kid",
+		},
+		Claims: claims,
+		Method: jwt.SigningMethodRS256,
+	}
+	t, _ := token.SignedString(pk)
+	return t
+}
@@ -0,0 +1,73 @@
+package decoder
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+var ErrInvalidAudience = errors.New("token audience is not accepted")
+
+// Confirmation is the "cnf" claim of a proof-of-possession token (RFC 7800).
+type Confirmation struct {
+	X5tS256 string `json:"x5t#S256,omitempty"`
+}
+
+// Audience is the "aud" claim, which is either a single string or an array
+// of strings.
+type Audience []string
+
+func (a *Audience) UnmarshalJSON(b []byte) error {
+	var single string
+	if err := json.Unmarshal(b, &single); err == nil {
+		*a = Audience{single}
+		return nil
+	}
+	var many []string
+	if err := json.Unmarshal(b, &many); err != nil {
+		return err
+	}
+	*a = many
+	return nil
+}
+
+// Contains reports whether aud is one of the audiences.
+func (a Audience) Contains(aud string) bool {
+	for _, v := range a {
+		if v == aud {
+			return true
+		}
+	}
+	return false
+}
+
+func verifyAudience(raw string, accepted []string) error {
+	var c struct {
+		Aud Audience `json:"aud"`
+	}
+	if err := payloadClaims(raw, &c); err != nil {
+		return err
+	}
+	for _, aud := range accepted {
+		if c.Aud.Contains(aud) {
+			return nil
+		}
+	}
+	return ErrInvalidAudience
+}
+
+// payloadClaims decodes the payload segment of a compact token into v,
+// independently of the claims type the caller gave to the parser.
+func payloadClaims(raw string, v interface{}) error {
+	parts := strings.Split(raw, ".")
+	if len(parts) != 3 {
+		return errors.New("token contains an invalid number of segments")
+	}
+	payload, err := jwt.DecodeSegment(parts[1])
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(payload, v)
+}
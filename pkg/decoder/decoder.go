@@ -1,7 +1,18 @@
 package decoder
 
-import "github.com/dgrijalva/jwt-go"
+import (
+	"context"
+
+	"github.com/dgrijalva/jwt-go"
+)
 
 type Decoder interface {
 	DecodeAccessTokenClaims(token, realm string, claims jwt.Claims) (*jwt.Token, error)
 }
+
+// ContextDecoder is implemented by decoders that honour a context, such as
+// the one returned by NewJwtDecoder. The context carries the parent span of
+// the decode span.
+type ContextDecoder interface {
+	DecodeAccessTokenClaimsContext(ctx context.Context, token, realm string, claims jwt.Claims) (*jwt.Token, error)
+}
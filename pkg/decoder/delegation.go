@@ -0,0 +1,144 @@
+package decoder
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+var (
+	ErrDelegationTooDeep = errors.New("token delegation chain is too deep")
+	ErrActorRequired     = errors.New("token is not acted on by a required actor")
+	ErrActorForbidden    = errors.New("token is acted on by a forbidden actor")
+)
+
+// Actor identifies a party of a token exchange (RFC 8693, section 4.1). In
+// an "act" claim Act is the prior actor the party is itself acting for.
+type Actor struct {
+	Subject  string `json:"sub,omitempty"`
+	Issuer   string `json:"iss,omitempty"`
+	ClientID string `json:"client_id,omitempty"`
+	Act      *Actor `json:"act,omitempty"`
+}
+
+// Delegation holds the token exchange claims of a token: "act", the actor
+// acting on behalf of the subject, and "may_act", the party allowed to
+// (RFC 8693, sections 4.1 and 4.4). The decoder enforces its policy on the
+// "act" chain only; MayAct is exposed for the caller to check.
+//
+// Embedded in the claims given to DecodeAccessTokenClaims, by value or as a
+// pointer that stays nil for tokens without "act", it is read from them
+// instead of the token payload.
+type Delegation struct {
+	Act    *Actor `json:"act,omitempty"`
+	MayAct *Actor `json:"may_act,omitempty"`
+}
+
+// Chain returns the actors of the "act" claim, the current actor first and
+// the earliest one last. It is empty for a token that was not delegated.
+func (d Delegation) Chain() []Actor {
+	var chain []Actor
+	for a := d.Act; a != nil; a = a.Act {
+		actor := *a
+		actor.Act = nil
+		chain = append(chain, actor)
+	}
+	return chain
+}
+
+// delegation returns the zero Delegation for claims that embed a nil
+// *Delegation, as they do for tokens without token exchange claims.
+func (d *Delegation) delegation() Delegation {
+	if d == nil {
+		return Delegation{}
+	}
+	return *d
+}
+
+// delegated is implemented by pointers to claims that embed Delegation, and by
+// claims that embed *Delegation.
+type delegated interface {
+	delegation() Delegation
+}
+
+// TokenDelegation returns the token exchange claims of a decoded token.
+func TokenDelegation(token *jwt.Token) (*Delegation, error) {
+	d, err := claimsDelegation(token.Claims, token.Raw)
+	if err != nil {
+		return nil, err
+	}
+	return &d, nil
+}
+
+// claimsDelegation returns the Delegation embedded in claims, or decodes it
+// from the payload of raw for other claims types.
+func claimsDelegation(claims jwt.Claims, raw string) (Delegation, error) {
+	if c, ok := claims.(delegated); ok {
+		return c.delegation(), nil
+	}
+	var d Delegation
+	err := payloadClaims(raw, &d)
+	return d, err
+}
+
+// delegationPolicy restricts the "act" chain of the tokens a decoder
+// accepts. A negative maxDepth means no limit.
+type delegationPolicy struct {
+	maxDepth  int
+	required  map[string]bool
+	forbidden map[string]bool
+}
+
+func (p delegationPolicy) enabled() bool {
+	return p.maxDepth >= 0 || len(p.required) > 0 || len(p.forbidden) > 0
+}
+
+// WithMaxDelegationDepth rejects tokens whose "act" chain has more than
+// depth actors with ErrDelegationTooDeep. Zero rejects every delegated token.
+func WithMaxDelegationDepth(depth int) Option {
+	return func(s *settings) {
+		s.delegation.maxDepth = depth
+	}
+}
+
+// WithRequiredActors rejects tokens whose current actor, the outermost "act"
+// claim, has none of subs as subject, with ErrActorRequired. Tokens that were
+// not delegated are rejected too.
+func WithRequiredActors(subs ...string) Option {
+	return func(s *settings) {
+		s.delegation.required = stringSet(subs)
+	}
+}
+
+// WithForbiddenActors rejects tokens with any of subs as subject anywhere in
+// their "act" chain, with ErrActorForbidden.
+func WithForbiddenActors(subs ...string) Option {
+	return func(s *settings) {
+		s.delegation.forbidden = stringSet(subs)
+	}
+}
+
+func (p delegationPolicy) verify(d Delegation) error {
+	chain := d.Chain()
+	if p.maxDepth >= 0 && len(chain) > p.maxDepth {
+		return fmt.Errorf("%w: %d actors, at most %d", ErrDelegationTooDeep, len(chain), p.maxDepth)
+	}
+	if len(p.required) > 0 && (len(chain) == 0 || !p.required[chain[0].Subject]) {
+		return ErrActorRequired
+	}
+	for _, a := range chain {
+		if p.forbidden[a.Subject] {
+			return fmt.Errorf("%w: %s", ErrActorForbidden, a.Subject)
+		}
+	}
+	return nil
+}
+
+func stringSet(values []string) map[string]bool {
+	set := make(map[string]bool, len(values))
+	for _, v := range values {
+		set[v] = true
+	}
+	return set
+}
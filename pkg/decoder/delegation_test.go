@@ -0,0 +1,147 @@
+package decoder
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/marcosgmgm/openid-decode-token/pkg/metrics"
+	"github.com/marcosgmgm/openid-decode-token/pkg/oidctest"
+)
+
+func TestTokenDelegation(t *testing.T) {
+	key, _ := oidctest.NewKey("RS256")
+	raw := oidctest.NewToken(key).
+		Act("gateway", "batch").
+		Claim("may_act", map[string]interface{}{"sub": "admin", "iss": "https://idp"}).
+		MustSign()
+	token, _, _ := new(jwt.Parser).ParseUnverified(raw, jwt.MapClaims{})
+	token.Raw = raw
+
+	d, err := TokenDelegation(token)
+	if err != nil {
+		t.Fatalf("TokenDelegation() error = %v", err)
+	}
+	if want := []Actor{{Subject: "gateway"}, {Subject: "batch"}}; !reflect.DeepEqual(d.Chain(), want) {
+		t.Errorf("Chain() = %+v, want %+v", d.Chain(), want)
+	}
+	if want := (&Actor{Subject: "admin", Issuer: "https://idp"}); !reflect.DeepEqual(d.MayAct, want) {
+		t.Errorf("MayAct = %+v, want %+v", d.MayAct, want)
+	}
+	if chain := (Delegation{}).Chain(); len(chain) != 0 {
+		t.Errorf("Chain() of an undelegated token = %+v", chain)
+	}
+}
+
+func Test_jwtDecoder_Delegation(t *testing.T) {
+	p := oidctest.NewProvider("test")
+	defer p.Close()
+	realm := p.Realm("test")
+	token := func(actors ...string) string {
+		return realm.NewToken().Subject("user").Act(actors...).MustSign()
+	}
+	tests := []struct {
+		name    string
+		opts    []Option
+		token   string
+		wantErr error
+	}{
+		{name: "no policy", token: token("gateway", "batch", "cron")},
+		{name: "within depth", opts: []Option{WithMaxDelegationDepth(2)}, token: token("gateway", "batch")},
+		{name: "too deep", opts: []Option{WithMaxDelegationDepth(2)}, token: token("gateway", "batch", "cron"), wantErr: ErrDelegationTooDeep},
+		{name: "no delegation allowed", opts: []Option{WithMaxDelegationDepth(0)}, token: token("gateway"), wantErr: ErrDelegationTooDeep},
+		{name: "not delegated", opts: []Option{WithMaxDelegationDepth(0)}, token: token()},
+		{name: "required actor", opts: []Option{WithRequiredActors("gateway", "proxy")}, token: token("gateway", "batch")},
+		{name: "required actor is only a prior actor", opts: []Option{WithRequiredActors("batch")}, token: token("gateway", "batch"), wantErr: ErrActorRequired},
+		{name: "required actor on undelegated token", opts: []Option{WithRequiredActors("gateway")}, token: token(), wantErr: ErrActorRequired},
+		{name: "forbidden current actor", opts: []Option{WithForbiddenActors("gateway")}, token: token("gateway"), wantErr: ErrActorForbidden},
+		{name: "forbidden prior actor", opts: []Option{WithForbiddenActors("batch")}, token: token("gateway", "batch"), wantErr: ErrActorForbidden},
+		{name: "no forbidden actor", opts: []Option{WithForbiddenActors("batch")}, token: token("gateway")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			j := NewJwtDecoder(p.Manager(), tt.opts...)
+			_, err := j.DecodeAccessTokenClaims(tt.token, "test", jwt.MapClaims{})
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("DecodeAccessTokenClaims() error = %v, want %v", err, tt.wantErr)
+			}
+			if err != nil && Outcome(err) != metrics.OutcomeInvalidDelegation {
+				t.Errorf("Outcome() = %s, want %s", Outcome(err), metrics.OutcomeInvalidDelegation)
+			}
+		})
+	}
+}
+
+func Test_jwtDecoder_DelegationMalformed(t *testing.T) {
+	p := oidctest.NewProvider("test")
+	defer p.Close()
+	token := p.Realm("test").NewToken().Claim("act", "gateway").MustSign()
+	j := NewJwtDecoder(p.Manager(), WithMaxDelegationDepth(1))
+	if _, err := j.DecodeAccessTokenClaims(token, "test", jwt.MapClaims{}); Outcome(err) != metrics.OutcomeMalformed {
+		t.Errorf("DecodeAccessTokenClaims() error = %v, want a malformed token", err)
+	}
+}
+
+type exchangedClaims struct {
+	jwt.StandardClaims
+	Delegation
+}
+
+type exchangedPointerClaims struct {
+	jwt.StandardClaims
+	*Delegation
+}
+
+func Test_jwtDecoder_DelegationEmbeddedPointer(t *testing.T) {
+	p := oidctest.NewProvider("test")
+	defer p.Close()
+	j := NewJwtDecoder(p.Manager(), WithMaxDelegationDepth(1))
+
+	// No "act" claim leaves the embedded pointer nil.
+	raw := p.Realm("test").NewToken().Subject("user").MustSign()
+	var claims exchangedPointerClaims
+	token, err := j.DecodeAccessTokenClaims(raw, "test", &claims)
+	if err != nil {
+		t.Fatalf("DecodeAccessTokenClaims() error = %v", err)
+	}
+	if claims.Delegation != nil {
+		t.Errorf("Delegation = %+v, want nil", claims.Delegation)
+	}
+	if d, err := TokenDelegation(token); err != nil || d.Act != nil {
+		t.Errorf("TokenDelegation() = %+v, %v", d, err)
+	}
+
+	raw = p.Realm("test").NewToken().Subject("user").Act("gateway", "batch").MustSign()
+	if _, err = j.DecodeAccessTokenClaims(raw, "test", &exchangedPointerClaims{}); !errors.Is(err, ErrDelegationTooDeep) {
+		t.Errorf("DecodeAccessTokenClaims() error = %v, want %v", err, ErrDelegationTooDeep)
+	}
+}
+
+func Test_jwtDecoder_DelegationEmbedded(t *testing.T) {
+	p := oidctest.NewProvider("test")
+	defer p.Close()
+	raw := p.Realm("test").NewToken().Subject("user").Act("gateway", "batch").MustSign()
+
+	var claims exchangedClaims
+	j := NewJwtDecoder(p.Manager(), WithRequiredActors("gateway"))
+	token, err := j.DecodeAccessTokenClaims(raw, "test", &claims)
+	if err != nil {
+		t.Fatalf("DecodeAccessTokenClaims() error = %v", err)
+	}
+	if want := []Actor{{Subject: "gateway"}, {Subject: "batch"}}; !reflect.DeepEqual(claims.Chain(), want) {
+		t.Errorf("Chain() = %+v, want %+v", claims.Chain(), want)
+	}
+	if d, err := TokenDelegation(token); err != nil || d.Act.Subject != "gateway" {
+		t.Errorf("TokenDelegation() = %+v, %v", d, err)
+	}
+	if _, err = NewJwtDecoder(p.Manager(), WithMaxDelegationDepth(1)).DecodeAccessTokenClaims(raw, "test", &exchangedClaims{}); !errors.Is(err, ErrDelegationTooDeep) {
+		t.Errorf("DecodeAccessTokenClaims() error = %v, want %v", err, ErrDelegationTooDeep)
+	}
+
+	// Embedded claims are read without decoding the payload again.
+	embedded := &jwt.Token{Claims: &exchangedClaims{Delegation: Delegation{Act: &Actor{Subject: "gateway"}}}}
+	if d, err := TokenDelegation(embedded); err != nil || d.Act.Subject != "gateway" {
+		t.Errorf("TokenDelegation() = %+v, %v", d, err)
+	}
+}
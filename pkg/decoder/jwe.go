@@ -0,0 +1,80 @@
+package decoder
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/go-jose/go-jose/v3"
+)
+
+var (
+	ErrNoDecryptionKey = errors.New("token is encrypted but no decryption key matches")
+	ErrNotNestedToken  = errors.New("encrypted token does not contain a signed JWT")
+)
+
+// DecryptionKey opens encrypted (JWE) tokens. Key is an *rsa.PrivateKey for
+// RSA-OAEP, an *ecdsa.PrivateKey for ECDH-ES or a []byte for AES key wrap and
+// direct encryption. When Kid is set, the key is only tried for tokens whose
+// header carries the same "kid".
+type DecryptionKey struct {
+	Kid string
+	Key interface{}
+}
+
+// allowedKeyAlgorithms leaves out RSA1_5 and PBES2, which are not expected
+// from an identity provider and are the usual attack surface of JWE.
+var allowedKeyAlgorithms = map[jose.KeyAlgorithm]bool{
+	jose.RSA_OAEP:       true,
+	jose.RSA_OAEP_256:   true,
+	jose.ECDH_ES:        true,
+	jose.ECDH_ES_A128KW: true,
+	jose.ECDH_ES_A192KW: true,
+	jose.ECDH_ES_A256KW: true,
+	jose.A128KW:         true,
+	jose.A192KW:         true,
+	jose.A256KW:         true,
+	jose.A128GCMKW:      true,
+	jose.A192GCMKW:      true,
+	jose.A256GCMKW:      true,
+	jose.DIRECT:         true,
+}
+
+// WithDecryptionKeys enables nested tokens: the outer JWE is decrypted with
+// one of the keys and the inner JWS is verified as any other token.
+func WithDecryptionKeys(keys ...DecryptionKey) Option {
+	return func(s *settings) {
+		s.decryptionKeys = append(s.decryptionKeys, keys...)
+	}
+}
+
+func (s *settings) decrypt(token string) (string, error) {
+	if len(s.decryptionKeys) == 0 {
+		return "", ErrNoDecryptionKey
+	}
+	jwe, err := jose.ParseEncrypted(token)
+	if err != nil {
+		return "", err
+	}
+	alg := jose.KeyAlgorithm(jwe.Header.Algorithm)
+	if !allowedKeyAlgorithms[alg] {
+		return "", fmt.Errorf("unexpected key management algorithm: %s", alg)
+	}
+	err = ErrNoDecryptionKey
+	for _, k := range s.decryptionKeys {
+		if len(k.Kid) > 0 && k.Kid != jwe.Header.KeyID {
+			continue
+		}
+		var plaintext []byte
+		plaintext, err = jwe.Decrypt(k.Key)
+		if err != nil {
+			continue
+		}
+		inner := string(plaintext)
+		if strings.Count(inner, ".") != 2 {
+			return "", ErrNotNestedToken
+		}
+		return inner, nil
+	}
+	return "", err
+}
@@ -0,0 +1,101 @@
+package decoder
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/go-jose/go-jose/v3"
+	"github.com/marcosgmgm/openid-decode-token/pkg/cert"
+)
+
+func Test_jwtDecoder_DecodeEncryptedToken(t *testing.T) {
+	pk, pub, _ := generateKeys()
+	encKey, _, _ := generateKeys()
+	otherKey, _, _ := generateKeys()
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	signed := generateToken(pk, "Can be anything", time.Minute)
+	manager := cert.ManagerCustomMock{
+		CertMock: func(kid, realm string) (*cert.Cert, error) {
+			return &cert.Cert{Kid: kid}, nil
+		},
+		PublicKeyMock: func(cert *cert.Cert) (*rsa.PublicKey, error) {
+			return pub, nil
+		},
+	}
+	tests := []struct {
+		name      string
+		token     string
+		keys      []DecryptionKey
+		wantToken string
+		wantErr   error
+	}{
+		{
+			name:      "success rsa-oaep",
+			token:     encryptToken(signed, jose.RSA_OAEP_256, &encKey.PublicKey, "enc"),
+			keys:      []DecryptionKey{{Kid: "enc", Key: encKey}},
+			wantToken: signed,
+		},
+		{
+			name:      "success ecdh-es",
+			token:     encryptToken(signed, jose.ECDH_ES, &ecKey.PublicKey, ""),
+			keys:      []DecryptionKey{{Key: otherKey}, {Key: ecKey}},
+			wantToken: signed,
+		},
+		{
+			name:    "no decryption keys",
+			token:   encryptToken(signed, jose.RSA_OAEP, &encKey.PublicKey, "enc"),
+			keys:    nil,
+			wantErr: ErrNoDecryptionKey,
+		},
+		{
+			name:    "kid does not match",
+			token:   encryptToken(signed, jose.RSA_OAEP, &encKey.PublicKey, "enc"),
+			keys:    []DecryptionKey{{Kid: "other", Key: encKey}},
+			wantErr: ErrNoDecryptionKey,
+		},
+		{
+			name:    "rsa1_5 rejected",
+			token:   encryptToken(signed, jose.RSA1_5, &encKey.PublicKey, "enc"),
+			keys:    []DecryptionKey{{Kid: "enc", Key: encKey}},
+			wantErr: errors.New("unexpected key management algorithm: RSA1_5"),
+		},
+		{
+			name:    "payload is not a jws",
+			token:   encryptToken("plain text", jose.RSA_OAEP, &encKey.PublicKey, "enc"),
+			keys:    []DecryptionKey{{Kid: "enc", Key: encKey}},
+			wantErr: ErrNotNestedToken,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			j := NewJwtDecoder(manager, WithDecryptionKeys(tt.keys...))
+			claims := jwt.MapClaims{}
+			got, err := j.DecodeAccessTokenClaims(tt.token, "test", claims)
+			if err != nil && tt.wantErr == nil {
+				t.Errorf("DecodeAccessTokenClaims() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if err != nil && err.Error() != tt.wantErr.Error() {
+				t.Errorf("DecodeAccessTokenClaims() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if err == nil && got.Raw != tt.wantToken {
+				t.Errorf("DecodeAccessTokenClaims() got = %v, want %v", got.Raw, tt.wantToken)
+			}
+		})
+	}
+}
+
+func encryptToken(payload string, alg jose.KeyAlgorithm, key interface{}, kid string) string {
+	opts := (&jose.EncrypterOptions{}).WithContentType("JWT")
+	enc, _ := jose.NewEncrypter(jose.A256GCM, jose.Recipient{Algorithm: alg, Key: key, KeyID: kid}, opts)
+	obj, _ := enc.Encrypt([]byte(payload))
+	t, _ := obj.CompactSerialize()
+	return t
+}
@@ -1,49 +1,356 @@
 package decoder
 
 import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
 	"crypto/rsa"
+	"errors"
 	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
 	"github.com/dgrijalva/jwt-go"
+	"github.com/marcosgmgm/openid-decode-token/internal/instrument"
 	"github.com/marcosgmgm/openid-decode-token/pkg/cert"
+	"github.com/marcosgmgm/openid-decode-token/pkg/metrics"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
 )
 
+// maxKidlessCandidates is the most keys a token without a kid is verified
+// against.
+const maxKidlessCandidates = 5
+
 type jwtDecoder struct {
+	settings
 	basePath    string
-	certsCache  map[string]*cert.Cert
+	certsCache  map[certKey]cachedCert
 	certManager cert.Manager
+	mu          sync.Mutex
+}
+
+// settings holds what the options configure, so that they can be resolved
+// without building a decoder.
+type settings struct {
+	decryptionKeys  []DecryptionKey
+	algorithms      map[string]bool
+	audiences       []string
+	kidlessFallback bool
+	keyCacheTTL     time.Duration
+	delegation      delegationPolicy
+	recorder        metrics.Recorder
+	tracer          trace.Tracer
+	logger          *slog.Logger
+}
+
+// certKey identifies a cached key. The realm is part of it so that a kid of
+// one realm never verifies tokens presented for another.
+type certKey struct {
+	realm string
+	kid   string
+}
+
+// cachedCert is a key looked up from the manager, reused until expires.
+type cachedCert struct {
+	cert    *cert.Cert
+	expires time.Time
+}
+
+// Option customizes the decoder built by NewJwtDecoder.
+type Option func(*settings)
+
+func newSettings(opts ...Option) settings {
+	s := settings{
+		keyCacheTTL: cert.DefaultKeySetTTL,
+		delegation:  delegationPolicy{maxDepth: -1},
+		recorder:    metrics.Nop{},
+		tracer:      noop.NewTracerProvider().Tracer(instrumentationName),
+		logger:      instrument.DiscardLogger,
+	}
+	for _, opt := range opts {
+		opt(&s)
+	}
+	return s
 }
 
-func NewJwtDecoder(certManager cert.Manager) Decoder {
+func NewJwtDecoder(certManager cert.Manager, opts ...Option) Decoder {
 	return &jwtDecoder{
-		certsCache: make(map[string]*cert.Cert),
+		settings:    newSettings(opts...),
+		certsCache:  make(map[certKey]cachedCert),
 		certManager: certManager,
 	}
 }
 
+// WithAlgorithms restricts the accepted "alg" header values. By default any
+// RSA signature algorithm is accepted; ES256, ES384 and ES512 tokens are only
+// verified when listed here.
+func WithAlgorithms(algs ...string) Option {
+	return func(s *settings) {
+		s.algorithms = make(map[string]bool, len(algs))
+		for _, alg := range algs {
+			s.algorithms[alg] = true
+		}
+	}
+}
+
+// WithAudiences rejects tokens whose "aud" claim contains none of auds.
+func WithAudiences(auds ...string) Option {
+	return func(s *settings) {
+		s.audiences = auds
+	}
+}
+
+// WithKidlessFallback verifies tokens without a "kid" header against each
+// published key that fits their algorithm, which requires a manager that
+// implements cert.KeySetManager. By default they are rejected with
+// ErrMissingKid.
+func WithKidlessFallback() Option {
+	return func(s *settings) {
+		s.kidlessFallback = true
+	}
+}
+
+// WithKeyCacheTTL sets how long the decoder reuses a key before looking it up
+// from the manager again, cert.DefaultKeySetTTL by default, so that a key the
+// identity provider withdrew stops verifying tokens. A zero ttl looks the key
+// up for every token.
+func WithKeyCacheTTL(ttl time.Duration) Option {
+	return func(s *settings) {
+		s.keyCacheTTL = ttl
+	}
+}
+
+// WithRecorder reports the outcome of every decoded token and the key cache
+// lookups to r.
+func WithRecorder(r metrics.Recorder) Option {
+	return func(s *settings) {
+		s.recorder = r
+	}
+}
+
 func (j *jwtDecoder) DecodeAccessTokenClaims(token, realm string, claims jwt.Claims) (*jwt.Token, error) {
-	return jwt.ParseWithClaims(token, claims, func(token *jwt.Token) (interface{}, error) {
-		kid := token.Header["kid"]
-		rsaPublicKey, err := j.publicKey(kid.(string), realm)
+	return j.DecodeAccessTokenClaimsContext(context.Background(), token, realm, claims)
+}
+
+func (j *jwtDecoder) DecodeAccessTokenClaimsContext(ctx context.Context, token, realm string, claims jwt.Claims) (t *jwt.Token, err error) {
+	ctx, span := j.tracer.Start(ctx, "decoder.DecodeAccessTokenClaims", trace.WithAttributes(attrRealm.String(realm)))
+	result := metrics.OutcomeDecryptionFailed
+	defer func() {
+		j.recorder.TokenValidated(realm, result)
+		if err != nil {
+			logRejected(ctx, j.logger, realm, result, err)
+		}
+		span.SetAttributes(attrOutcome.String(result))
+		instrument.EndSpan(span, err)
+	}()
+	if strings.Count(token, ".") == 4 {
+		if token, err = j.decrypt(token); err != nil {
+			return nil, err
+		}
+	}
+	t, err = j.verify(ctx, token, realm, claims)
+	result = Outcome(err)
+	return t, err
+}
+
+func (j *jwtDecoder) verify(ctx context.Context, token, realm string, claims jwt.Claims) (*jwt.Token, error) {
+	span := trace.SpanFromContext(ctx)
+	// candidates are the keys left to try for a token without a kid.
+	var candidates []crypto.PublicKey
+	t, err := jwt.ParseWithClaims(token, claims, func(token *jwt.Token) (interface{}, error) {
+		span.SetAttributes(attrAlg.String(token.Method.Alg()))
+		if !j.algorithmAllowed(token.Method) {
+			return nil, fmt.Errorf("%w: %v", ErrUnexpectedSigningMethod, token.Header["alg"])
+		}
+		kid, err := headerKid(token.Header)
+		if errors.Is(err, ErrMissingKid) && j.kidlessFallback {
+			keys, err := j.candidateKeys(ctx, token.Method, realm)
+			if err != nil {
+				return nil, err
+			}
+			candidates = keys[1:]
+			return keys[0], nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		span.SetAttributes(attrKid.String(kid))
+		key, err := j.publicKey(ctx, kid, realm)
 		if err != nil {
 			return nil, err
 		}
 		// Don't forget to validate the alg is what you expect:
-		if _, ok := token.Method.(*jwt.SigningMethodRSA); !ok {
-			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		if !keyMatches(token.Method, key) {
+			return nil, fmt.Errorf("%w: %v", ErrUnexpectedSigningMethod, token.Header["alg"])
 		}
-		return rsaPublicKey, nil
+		return key, nil
 	})
+	for len(candidates) > 0 && signatureInvalid(err) {
+		key := candidates[0]
+		candidates = candidates[1:]
+		t, err = jwt.ParseWithClaims(token, claims, func(*jwt.Token) (interface{}, error) {
+			return key, nil
+		})
+	}
+	if err != nil {
+		return t, err
+	}
+	if len(j.audiences) > 0 {
+		if err = verifyAudience(t.Raw, j.audiences); err != nil {
+			return nil, err
+		}
+	}
+	if j.delegation.enabled() {
+		d, err := claimsDelegation(t.Claims, t.Raw)
+		if err != nil {
+			return nil, err
+		}
+		if err = j.delegation.verify(d); err != nil {
+			return nil, err
+		}
+	}
+	return t, nil
+}
+
+// algorithmAllowed reports whether tokens signed with method are accepted:
+// the algorithms of WithAlgorithms, or the RSA ones by default.
+func (j *jwtDecoder) algorithmAllowed(method jwt.SigningMethod) bool {
+	if len(j.algorithms) > 0 {
+		return j.algorithms[method.Alg()]
+	}
+	_, ok := method.(*jwt.SigningMethodRSA)
+	return ok
+}
+
+// keyMatches reports whether key can verify signatures of method: an RSA key
+// for RS256, RS384 and RS512, an EC key on the curve of ES256, ES384 or ES512.
+func keyMatches(method jwt.SigningMethod, key crypto.PublicKey) bool {
+	switch m := method.(type) {
+	case *jwt.SigningMethodRSA:
+		_, ok := key.(*rsa.PublicKey)
+		return ok
+	case *jwt.SigningMethodECDSA:
+		k, ok := key.(*ecdsa.PublicKey)
+		return ok && k.Curve.Params().BitSize == m.CurveBits
+	}
+	return false
 }
 
-func (j *jwtDecoder) publicKey(kid, realm string) (*rsa.PublicKey, error) {
-	c := j.certsCache[kid]
+// headerKid returns the "kid" header parameter, which must be a non-empty
+// string when present.
+func headerKid(header map[string]interface{}) (string, error) {
+	v, ok := header["kid"]
+	if !ok || v == nil {
+		return "", ErrMissingKid
+	}
+	kid, ok := v.(string)
+	if !ok {
+		return "", fmt.Errorf("%w: %T", ErrInvalidKid, v)
+	}
+	if len(kid) == 0 {
+		return "", ErrMissingKid
+	}
+	return kid, nil
+}
+
+func (j *jwtDecoder) publicKey(ctx context.Context, kid, realm string) (crypto.PublicKey, error) {
+	k := certKey{realm, kid}
+	j.mu.Lock()
+	cached, ok := j.certsCache[k]
+	j.mu.Unlock()
+	c := cached.cert
+	if ok && !time.Now().Before(cached.expires) {
+		c = nil
+	}
+	j.recorder.KeyCacheLookup(realm, c != nil)
+	trace.SpanFromContext(ctx).SetAttributes(attrCacheHit.Bool(c != nil))
 	var err error
 	if c == nil {
-		c, err = j.certManager.Cert(kid, realm)
+		if cm, ok := j.certManager.(cert.ContextManager); ok {
+			c, err = cm.CertContext(ctx, kid, realm)
+		} else {
+			c, err = j.certManager.Cert(kid, realm)
+		}
+		j.mu.Lock()
+		if err != nil {
+			delete(j.certsCache, k)
+		} else {
+			j.certsCache[k] = cachedCert{cert: c, expires: time.Now().Add(j.keyCacheTTL)}
+		}
+		j.mu.Unlock()
 		if err != nil {
 			return nil, err
 		}
-		j.certsCache[kid] = c
 	}
-	return j.certManager.PublicKey(c)
+	return j.key(c)
+}
+
+func (j *jwtDecoder) key(c *cert.Cert) (crypto.PublicKey, error) {
+	if km, ok := j.certManager.(cert.KeyManager); ok {
+		return km.Key(c)
+	}
+	key, err := j.certManager.PublicKey(c)
+	if err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// candidateKeys returns the keys of realm that can verify a token signed with
+// method, for tokens without a kid when WithKidlessFallback is set. Keys of
+// another type, meant for encryption or published for another algorithm are
+// left out. Realms with more than maxKidlessCandidates such keys are refused,
+// each one costing a signature verification.
+func (j *jwtDecoder) candidateKeys(ctx context.Context, method jwt.SigningMethod, realm string) ([]crypto.PublicKey, error) {
+	ksm, ok := j.certManager.(cert.KeySetManager)
+	if !ok {
+		return nil, fmt.Errorf("%w: the manager does not list the keys of realm %s", ErrNoMatchingKey, realm)
+	}
+	certs, err := ksm.KeySet(ctx, realm)
+	if err != nil {
+		return nil, err
+	}
+	var fitting []*cert.Cert
+	for i := range certs {
+		c := &certs[i]
+		if c.Use == "enc" || c.Kty != keyType(method) || (len(c.Alg) > 0 && c.Alg != method.Alg()) {
+			continue
+		}
+		fitting = append(fitting, c)
+	}
+	if len(fitting) > maxKidlessCandidates {
+		return nil, fmt.Errorf("%w: %d candidate keys in realm %s, at most %d are tried without a kid", ErrNoMatchingKey, len(fitting), realm, maxKidlessCandidates)
+	}
+	var keys []crypto.PublicKey
+	for _, c := range fitting {
+		if key, err := j.key(c); err == nil && keyMatches(method, key) {
+			keys = append(keys, key)
+		}
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("%w: no %s key in realm %s", ErrNoMatchingKey, method.Alg(), realm)
+	}
+	trace.SpanFromContext(ctx).SetAttributes(attrCandidates.Int(len(keys)))
+	return keys, nil
+}
+
+// keyType returns the "kty" of the keys that verify signatures of method.
+func keyType(method jwt.SigningMethod) string {
+	switch method.(type) {
+	case *jwt.SigningMethodRSA:
+		return "RSA"
+	case *jwt.SigningMethodECDSA:
+		return "EC"
+	}
+	return ""
+}
+
+// signatureInvalid reports whether err is a signature mismatch, the error
+// worth trying the next candidate key for.
+func signatureInvalid(err error) bool {
+	var ve *jwt.ValidationError
+	return errors.As(err, &ve) && ve.Errors&jwt.ValidationErrorSignatureInvalid != 0
 }
@@ -1,11 +1,14 @@
 package decoder
 
 import (
+	"context"
 	"crypto/rand"
 	"crypto/rsa"
 	"errors"
 	"github.com/dgrijalva/jwt-go"
 	"github.com/marcosgmgm/openid-decode-token/pkg/cert"
+	"github.com/marcosgmgm/openid-decode-token/pkg/metrics"
+	"github.com/marcosgmgm/openid-decode-token/pkg/oidctest"
 	"reflect"
 	"testing"
 	"time"
@@ -130,7 +133,7 @@ func Test_jwtDecoder_DecodeAccessTokenClaims(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			j := NewJwtDecoder(tt.fields.basePath, tt.fields.certManager)
+			j := NewJwtDecoder(tt.fields.certManager)
 			claims := jwt.MapClaims{}
 			got, err := j.DecodeAccessTokenClaims(tt.args.token, tt.args.realm, claims)
 			if err != nil && tt.wantErr == nil {
@@ -154,6 +157,94 @@ func Test_jwtDecoder_DecodeAccessTokenClaims(t *testing.T) {
 }
 
 
+func Test_jwtDecoder_KidHeader(t *testing.T) {
+	pk, pub, _ := generateKeys()
+	key, _ := oidctest.NewKeyFromSigner(jwt.SigningMethodRS256.Alg(), pk)
+	manager := cert.ManagerCustomMock{
+		CertMock: func(kid, realm string) (*cert.Cert, error) {
+			return &cert.Cert{Kid: kid}, nil
+		},
+		PublicKeyMock: func(cert *cert.Cert) (*rsa.PublicKey, error) {
+			return pub, nil
+		},
+		KeySetMock: func(ctx context.Context, realm string) ([]cert.Cert, error) {
+			return []cert.Cert{key.Public()}, nil
+		},
+	}
+	tests := []struct {
+		name     string
+		kid      interface{}
+		fallback bool
+		wantErr  error
+	}{
+		{name: "string kid", kid: "kid"},
+		{name: "no kid", wantErr: ErrMissingKid},
+		{name: "empty kid", kid: "", wantErr: ErrMissingKid},
+		{name: "numeric kid", kid: 42, wantErr: ErrInvalidKid},
+		{name: "object kid", kid: map[string]interface{}{"kid": "kid"}, wantErr: ErrInvalidKid},
+		{name: "array kid", kid: []string{"kid"}, wantErr: ErrInvalidKid},
+		{name: "no kid with fallback", fallback: true},
+		{name: "empty kid with fallback", kid: "", fallback: true},
+		{name: "numeric kid with fallback", kid: 42, fallback: true, wantErr: ErrInvalidKid},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var opts []Option
+			if tt.fallback {
+				opts = append(opts, WithKidlessFallback())
+			}
+			j := NewJwtDecoder(manager, opts...)
+			token := oidctest.NewToken(key).Header("kid", tt.kid).MustSign()
+			_, err := j.DecodeAccessTokenClaims(token, "test", jwt.MapClaims{})
+			if tt.wantErr == nil {
+				if err != nil {
+					t.Fatalf("DecodeAccessTokenClaims() error = %v", err)
+				}
+				return
+			}
+			var ve *jwt.ValidationError
+			if !errors.As(err, &ve) || !errors.Is(ve.Inner, tt.wantErr) {
+				t.Fatalf("DecodeAccessTokenClaims() error = %v, want %v", err, tt.wantErr)
+			}
+			if got := Outcome(err); got != metrics.OutcomeMalformed {
+				t.Errorf("Outcome() = %s, want %s", got, metrics.OutcomeMalformed)
+			}
+		})
+	}
+}
+
+
+func Test_jwtDecoder_CacheKeyedByRealm(t *testing.T) {
+	pk, pub, _ := generateKeys()
+	_, other, _ := generateKeys()
+	lookups := map[string]int{}
+	manager := cert.ManagerCustomMock{
+		CertMock: func(kid, realm string) (*cert.Cert, error) {
+			lookups[realm]++
+			return &cert.Cert{Kid: kid, Use: realm}, nil
+		},
+		PublicKeyMock: func(c *cert.Cert) (*rsa.PublicKey, error) {
+			if c.Use == "trusted" {
+				return pub, nil
+			}
+			return other, nil
+		},
+	}
+	j := NewJwtDecoder(manager)
+	token := generateToken(pk, "Can be anything", time.Minute)
+	for i := 0; i < 2; i++ {
+		if _, err := j.DecodeAccessTokenClaims(token, "trusted", jwt.MapClaims{}); err != nil {
+			t.Fatalf("DecodeAccessTokenClaims() error = %v", err)
+		}
+	}
+	if _, err := j.DecodeAccessTokenClaims(token, "untrusted", jwt.MapClaims{}); err == nil {
+		t.Error("DecodeAccessTokenClaims() verified a token with the key cached for another realm")
+	}
+	if want := map[string]int{"trusted": 1, "untrusted": 1}; !reflect.DeepEqual(lookups, want) {
+		t.Errorf("Cert() lookups = %v, want %v", lookups, want)
+	}
+}
+
 func generateKeys() (pk *rsa.PrivateKey, pub *rsa.PublicKey, err error){
 	pk, err = rsa.GenerateKey(rand.Reader, 2048)
 	if err != nil {
@@ -217,4 +308,4 @@ func generateTokenInvalidSigningMethod(content interface{}, ttl time.Duration) s
 	}
 	t, _ := token.SignedString(jwt.UnsafeAllowNoneSignatureType)
 	return t
-}
\ No newline at end of file
+}
@@ -0,0 +1,25 @@
+package decoder
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/marcosgmgm/openid-decode-token/pkg/metrics"
+)
+
+// WithLogger logs why tokens are rejected: at warn level when their key
+// could not be found or was rejected by the key policy, at info level
+// otherwise. Tokens themselves are never logged.
+func WithLogger(l *slog.Logger) Option {
+	return func(s *settings) {
+		s.logger = l
+	}
+}
+
+func logRejected(ctx context.Context, l *slog.Logger, realm, result string, err error) {
+	level := slog.LevelInfo
+	if result == metrics.OutcomeKeyUnavailable || result == metrics.OutcomeKeyRejected {
+		level = slog.LevelWarn
+	}
+	l.Log(ctx, level, "token rejected", "realm", realm, "outcome", result, "error", err)
+}
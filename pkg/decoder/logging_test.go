@@ -0,0 +1,73 @@
+package decoder
+
+import (
+	"bytes"
+	"crypto/rsa"
+	"errors"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/marcosgmgm/openid-decode-token/pkg/cert"
+)
+
+func Test_jwtDecoder_Logger(t *testing.T) {
+	pk, pub, _ := generateKeys()
+	tests := []struct {
+		name      string
+		token     string
+		certErr   error
+		wantLevel string
+		wantLog   string
+	}{
+		{
+			name:  "valid",
+			token: generateToken(pk, "Can be anything", time.Minute),
+		},
+		{
+			name:      "expired",
+			token:     generateToken(pk, "Can be anything", -time.Minute),
+			wantLevel: "INFO",
+			wantLog:   "outcome=expired",
+		},
+		{
+			name:      "key unavailable",
+			token:     generateToken(pk, "Can be anything", time.Minute),
+			certErr:   errors.New("error cert"),
+			wantLevel: "WARN",
+			wantLog:   "outcome=key_unavailable error=\"error cert\"",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			certManager := cert.ManagerCustomMock{
+				CertMock: func(kid, realm string) (*cert.Cert, error) {
+					return &cert.Cert{Kid: kid}, tt.certErr
+				},
+				PublicKeyMock: func(cert *cert.Cert) (*rsa.PublicKey, error) {
+					return pub, nil
+				},
+			}
+			j := NewJwtDecoder(certManager, WithLogger(slog.New(slog.NewTextHandler(&buf, nil))))
+			_, _ = j.DecodeAccessTokenClaims(tt.token, "test", jwt.MapClaims{})
+			got := buf.String()
+			if len(tt.wantLog) == 0 {
+				if len(got) > 0 {
+					t.Errorf("log = %q, want none", got)
+				}
+				return
+			}
+			if !strings.Contains(got, "level="+tt.wantLevel) || !strings.Contains(got, tt.wantLog) {
+				t.Errorf("log = %q, want level %s and %q", got, tt.wantLevel, tt.wantLog)
+			}
+			for _, part := range strings.Split(tt.token, ".") {
+				if strings.Contains(got, part) {
+					t.Errorf("log = %q contains the token", got)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,38 @@
+package decoder
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+func TestDecoderFake(t *testing.T) {
+	fake := NewDecoderFake()
+	fake.SetClaims("valid", map[string]interface{}{"sub": "user", "aud": []string{"api"}})
+	fake.SetError("expired", &jwt.ValidationError{Errors: jwt.ValidationErrorExpired})
+
+	claims := jwt.MapClaims{}
+	token, err := fake.DecodeAccessTokenClaims("valid", "test", claims)
+	if err != nil || !token.Valid || token.Raw != "valid" || claims["sub"] != "user" {
+		t.Errorf("DecodeAccessTokenClaims() = %v, %v, claims %v", token, err, claims)
+	}
+	var typed struct {
+		jwt.StandardClaims
+		Aud Audience `json:"aud"`
+	}
+	if _, err = fake.DecodeAccessTokenClaims("valid", "test", &typed); err != nil || typed.Subject != "user" || !typed.Aud.Contains("api") {
+		t.Errorf("DecodeAccessTokenClaims() = %v, claims %+v", err, typed)
+	}
+	if _, err = fake.DecodeAccessTokenClaims("expired", "test", jwt.MapClaims{}); Outcome(err) != "expired" {
+		t.Errorf("DecodeAccessTokenClaims() error = %v, want expired", err)
+	}
+	if _, err = fake.DecodeAccessTokenClaims("unknown", "other", jwt.MapClaims{}); !errors.Is(err, ErrUnknownToken) {
+		t.Errorf("DecodeAccessTokenClaims() error = %v, wantErr %v", err, ErrUnknownToken)
+	}
+	want := []DecoderCall{{"valid", "test"}, {"valid", "test"}, {"expired", "test"}, {"unknown", "other"}}
+	if !reflect.DeepEqual(fake.Calls(), want) {
+		t.Errorf("Calls() = %v, want %v", fake.Calls(), want)
+	}
+}
@@ -0,0 +1,96 @@
+package decoder
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/marcosgmgm/openid-decode-token/pkg/cert"
+	"github.com/marcosgmgm/openid-decode-token/pkg/metrics"
+)
+
+var ErrUnknownIssuer = errors.New("token issuer is not trusted")
+
+// TrustedIssuer describes an identity provider accepted by a multi-issuer
+// decoder. Manager and Realm locate the issuer's keys, for example a
+// NewCertManager pointing at the provider's discovery base path.
+type TrustedIssuer struct {
+	// Issuer is compared exactly with the token "iss" claim.
+	Issuer  string
+	Manager cert.Manager
+	Realm   string
+	// Audiences accepted in the "aud" claim, any audience when empty.
+	Audiences []string
+	// Algorithms accepted in the "alg" header, any RSA algorithm when empty.
+	Algorithms []string
+}
+
+// IssuerDecoder decodes tokens without being told where they come from.
+type IssuerDecoder interface {
+	DecodeClaims(token string, claims jwt.Claims) (*jwt.Token, error)
+}
+
+type trustedDecoder struct {
+	realm   string
+	decoder Decoder
+}
+
+type multiIssuerDecoder struct {
+	settings
+	issuers map[string]trustedDecoder
+}
+
+// NewMultiIssuerDecoder returns a decoder that reads the unverified "iss"
+// claim, of the inner token when the token is encrypted, rejects tokens from issuers not in the list before any network call,
+// and verifies the others with the keys, audiences and algorithms of their
+// issuer. opts apply to the decoder of every issuer.
+func NewMultiIssuerDecoder(issuers []TrustedIssuer, opts ...Option) IssuerDecoder {
+	m := multiIssuerDecoder{
+		settings: newSettings(opts...),
+		issuers:  make(map[string]trustedDecoder, len(issuers)),
+	}
+	for _, ti := range issuers {
+		issuerOpts := append([]Option{}, opts...)
+		if len(ti.Audiences) > 0 {
+			issuerOpts = append(issuerOpts, WithAudiences(ti.Audiences...))
+		}
+		if len(ti.Algorithms) > 0 {
+			issuerOpts = append(issuerOpts, WithAlgorithms(ti.Algorithms...))
+		}
+		m.issuers[ti.Issuer] = trustedDecoder{
+			realm:   ti.Realm,
+			decoder: NewJwtDecoder(ti.Manager, issuerOpts...),
+		}
+	}
+	return m
+}
+
+func (m multiIssuerDecoder) DecodeClaims(token string, claims jwt.Claims) (*jwt.Token, error) {
+	if strings.Count(token, ".") == 4 {
+		inner, err := m.decrypt(token)
+		if err != nil {
+			return m.reject(metrics.OutcomeDecryptionFailed, err)
+		}
+		token = inner
+	}
+	var c struct {
+		Iss string `json:"iss"`
+	}
+	if err := payloadClaims(token, &c); err != nil {
+		return m.reject(metrics.OutcomeMalformed, err)
+	}
+	td, ok := m.issuers[c.Iss]
+	if !ok {
+		return m.reject(metrics.OutcomeUnknownIssuer, fmt.Errorf("%w: %q", ErrUnknownIssuer, c.Iss))
+	}
+	return td.decoder.DecodeAccessTokenClaims(token, td.realm, claims)
+}
+
+// reject records a token turned down before it reaches an issuer's decoder.
+func (m multiIssuerDecoder) reject(result string, err error) (*jwt.Token, error) {
+	m.recorder.TokenValidated(metrics.RealmUnknown, result)
+	logRejected(context.Background(), m.logger, metrics.RealmUnknown, result, err)
+	return nil, err
+}
@@ -0,0 +1,167 @@
+package decoder
+
+import (
+	"crypto/rsa"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/go-jose/go-jose/v3"
+	"github.com/marcosgmgm/openid-decode-token/pkg/cert"
+	"github.com/marcosgmgm/openid-decode-token/pkg/metrics"
+)
+
+func Test_multiIssuerDecoder_DecodeClaims(t *testing.T) {
+	keycloakKey, keycloakPub, _ := generateKeys()
+	azureKey, azurePub, _ := generateKeys()
+	encKey, _, _ := generateKeys()
+	otherKey, _, _ := generateKeys()
+	calls := 0
+	var outcome, outcomeRealm string
+	managerFor := func(pub *rsa.PublicKey) cert.Manager {
+		return cert.ManagerCustomMock{
+			CertMock: func(kid, realm string) (*cert.Cert, error) {
+				calls++
+				return &cert.Cert{Kid: kid}, nil
+			},
+			PublicKeyMock: func(cert *cert.Cert) (*rsa.PublicKey, error) {
+				return pub, nil
+			},
+		}
+	}
+	d := NewMultiIssuerDecoder([]TrustedIssuer{
+		{
+			Issuer:    "https://keycloak/realms/test",
+			Manager:   managerFor(keycloakPub),
+			Realm:     "test",
+			Audiences: []string{"gateway"},
+		},
+		{
+			Issuer:     "https://login.microsoftonline.com/tenant/v2.0",
+			Manager:    managerFor(azurePub),
+			Algorithms: []string{"RS256"},
+		},
+	},
+		WithDecryptionKeys(DecryptionKey{Kid: "enc", Key: encKey}),
+		WithRecorder(metrics.RecorderCustomMock{
+			TokenValidatedMock: func(realm, result string) { outcomeRealm, outcome = realm, result },
+		}),
+	)
+	keycloakToken := generateIssuerToken(keycloakKey, jwt.SigningMethodRS256, "https://keycloak/realms/test", "gateway")
+	tests := []struct {
+		name         string
+		token        string
+		wantErr      error
+		wantNoLookup bool
+		wantOutcome  string
+		wantRealm    string
+	}{
+		{
+			name:         "unknown issuer",
+			token:        generateIssuerToken(keycloakKey, jwt.SigningMethodRS256, "https://evil", "gateway"),
+			wantErr:      ErrUnknownIssuer,
+			wantNoLookup: true,
+			wantOutcome:  metrics.OutcomeUnknownIssuer,
+			wantRealm:    metrics.RealmUnknown,
+		},
+		{
+			name:         "malformed",
+			token:        "not-a-token",
+			wantErr:      errors.New("token contains an invalid number of segments"),
+			wantNoLookup: true,
+			wantOutcome:  metrics.OutcomeMalformed,
+			wantRealm:    metrics.RealmUnknown,
+		},
+		{
+			name:        "encrypted",
+			token:       encryptToken(keycloakToken, jose.RSA_OAEP_256, &encKey.PublicKey, "enc"),
+			wantOutcome: metrics.OutcomeValid,
+			wantRealm:   "test",
+		},
+		{
+			name:         "encrypted unknown issuer",
+			token:        encryptToken(generateIssuerToken(keycloakKey, jwt.SigningMethodRS256, "https://evil", "gateway"), jose.RSA_OAEP_256, &encKey.PublicKey, "enc"),
+			wantErr:      ErrUnknownIssuer,
+			wantNoLookup: true,
+			wantOutcome:  metrics.OutcomeUnknownIssuer,
+		},
+		{
+			name:         "encrypted for another key",
+			token:        encryptToken(keycloakToken, jose.RSA_OAEP_256, &otherKey.PublicKey, ""),
+			wantErr:      ErrNoDecryptionKey,
+			wantNoLookup: true,
+			wantOutcome:  metrics.OutcomeDecryptionFailed,
+		},
+		{
+			name:         "algorithm not allowed",
+			token:        generateIssuerToken(azureKey, jwt.SigningMethodRS512, "https://login.microsoftonline.com/tenant/v2.0", "api"),
+			wantErr:      errors.New("unexpected signing method: RS512"),
+			wantNoLookup: true,
+		},
+		{
+			name:  "keycloak",
+			token: keycloakToken,
+		},
+		{
+			name:  "keycloak audience array",
+			token: generateIssuerToken(keycloakKey, jwt.SigningMethodRS256, "https://keycloak/realms/test", []string{"account", "gateway"}),
+		},
+		{
+			name:  "azure",
+			token: generateIssuerToken(azureKey, jwt.SigningMethodRS256, "https://login.microsoftonline.com/tenant/v2.0", "api"),
+		},
+		{
+			name:    "wrong audience",
+			token:   generateIssuerToken(keycloakKey, jwt.SigningMethodRS256, "https://keycloak/realms/test", "other"),
+			wantErr: ErrInvalidAudience,
+		},
+		{
+			name:    "signed by another issuer",
+			token:   generateIssuerToken(azureKey, jwt.SigningMethodRS256, "https://keycloak/realms/test", "gateway"),
+			wantErr: rsa.ErrVerification,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls, outcome, outcomeRealm = 0, "", ""
+			_, err := d.DecodeClaims(tt.token, jwt.MapClaims{})
+			if tt.wantErr == nil && err != nil {
+				t.Errorf("DecodeClaims() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErr != nil && (err == nil || (!errors.Is(err, tt.wantErr) && err.Error() != tt.wantErr.Error())) {
+				t.Errorf("DecodeClaims() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantNoLookup && calls != 0 {
+				t.Errorf("DecodeClaims() key lookups = %d, want none", calls)
+			}
+			if len(tt.wantOutcome) > 0 && outcome != tt.wantOutcome {
+				t.Errorf("DecodeClaims() outcome = %v, want %v", outcome, tt.wantOutcome)
+			}
+			if len(tt.wantRealm) > 0 && outcomeRealm != tt.wantRealm {
+				t.Errorf("DecodeClaims() outcome realm = %v, want %v", outcomeRealm, tt.wantRealm)
+			}
+		})
+	}
+}
+
+func generateIssuerToken(pk *rsa.PrivateKey, method jwt.SigningMethod, iss string, aud interface{}) string {
+	now := time.Now().UTC()
+	claims := make(jwt.MapClaims)
+	claims["iss"] = iss
+	claims["aud"] = aud
+	claims["exp"] = now.Add(time.Minute).Unix()
+	token := &jwt.Token{
+		Header: map[string]interface{}{
+			"typ": "JWT",
+			"alg": method.Alg(),
+			"kid": "kid",
+		},
+		Claims: claims,
+		Method: method,
+	}
+	t, _ := token.SignedString(pk)
+	return t
+}
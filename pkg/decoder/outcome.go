@@ -0,0 +1,57 @@
+package decoder
+
+import (
+	"errors"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/marcosgmgm/openid-decode-token/pkg/cert"
+	"github.com/marcosgmgm/openid-decode-token/pkg/metrics"
+)
+
+var (
+	ErrUnexpectedSigningMethod = errors.New("unexpected signing method")
+	ErrNoMatchingKey           = errors.New("no key matches the token")
+	ErrMissingKid              = errors.New("token has no kid")
+	ErrInvalidKid              = errors.New("token kid is not a string")
+)
+
+// Outcome classifies an error returned by a decoder as one of the
+// metrics.Outcome constants, metrics.OutcomeValid for a nil error.
+func Outcome(err error) string {
+	switch {
+	case err == nil:
+		return metrics.OutcomeValid
+	case errors.Is(err, ErrInvalidAudience):
+		return metrics.OutcomeInvalidAudience
+	case errors.Is(err, ErrUnknownIssuer):
+		return metrics.OutcomeUnknownIssuer
+	case errors.Is(err, ErrDelegationTooDeep), errors.Is(err, ErrActorRequired), errors.Is(err, ErrActorForbidden):
+		return metrics.OutcomeInvalidDelegation
+	}
+	var ve *jwt.ValidationError
+	if !errors.As(err, &ve) {
+		return metrics.OutcomeMalformed
+	}
+	switch {
+	case ve.Errors&jwt.ValidationErrorMalformed != 0:
+		return metrics.OutcomeMalformed
+	case ve.Errors&jwt.ValidationErrorUnverifiable != 0:
+		if ve.Inner == nil || errors.Is(ve.Inner, ErrUnexpectedSigningMethod) {
+			return metrics.OutcomeInvalidAlgorithm
+		}
+		if errors.Is(ve.Inner, ErrMissingKid) || errors.Is(ve.Inner, ErrInvalidKid) {
+			return metrics.OutcomeMalformed
+		}
+		if errors.Is(ve.Inner, cert.ErrKeyRejected) {
+			return metrics.OutcomeKeyRejected
+		}
+		return metrics.OutcomeKeyUnavailable
+	case ve.Errors&jwt.ValidationErrorSignatureInvalid != 0:
+		return metrics.OutcomeInvalidSignature
+	case ve.Errors&jwt.ValidationErrorExpired != 0:
+		return metrics.OutcomeExpired
+	case ve.Errors&jwt.ValidationErrorNotValidYet != 0:
+		return metrics.OutcomeNotYetValid
+	}
+	return metrics.OutcomeInvalidClaims
+}
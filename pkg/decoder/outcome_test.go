@@ -0,0 +1,118 @@
+package decoder
+
+import (
+	"crypto/rsa"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/marcosgmgm/openid-decode-token/pkg/cert"
+	"github.com/marcosgmgm/openid-decode-token/pkg/metrics"
+)
+
+func Test_jwtDecoder_Recorder(t *testing.T) {
+	pk, pub, _ := generateKeys()
+	other, _, _ := generateKeys()
+	tests := []struct {
+		name        string
+		token       string
+		opts        []Option
+		certErr     error
+		wantOutcome string
+	}{
+		{
+			name:        "valid",
+			token:       generateToken(pk, "Can be anything", time.Minute),
+			wantOutcome: metrics.OutcomeValid,
+		},
+		{
+			name:        "expired",
+			token:       generateToken(pk, "Can be anything", -time.Minute),
+			wantOutcome: metrics.OutcomeExpired,
+		},
+		{
+			name:        "invalid signature",
+			token:       generateToken(other, "Can be anything", time.Minute),
+			wantOutcome: metrics.OutcomeInvalidSignature,
+		},
+		{
+			name:        "malformed",
+			token:       generateInvalidToken("Can be anything"),
+			wantOutcome: metrics.OutcomeMalformed,
+		},
+		{
+			name:        "invalid algorithm",
+			token:       generateTokenInvalidSigningMethod("Can be anything", time.Minute),
+			wantOutcome: metrics.OutcomeInvalidAlgorithm,
+		},
+		{
+			name:        "key unavailable",
+			token:       generateToken(pk, "Can be anything", time.Minute),
+			certErr:     errors.New("error cert"),
+			wantOutcome: metrics.OutcomeKeyUnavailable,
+		},
+		{
+			name:        "invalid audience",
+			token:       generateToken(pk, "Can be anything", time.Minute),
+			opts:        []Option{WithAudiences("api")},
+			wantOutcome: metrics.OutcomeInvalidAudience,
+		},
+		{
+			name:        "decryption failed",
+			token:       "a.b.c.d.e",
+			wantOutcome: metrics.OutcomeDecryptionFailed,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var outcomes []string
+			recorder := metrics.RecorderCustomMock{
+				TokenValidatedMock: func(realm, outcome string) {
+					outcomes = append(outcomes, realm+"/"+outcome)
+				},
+			}
+			certManager := cert.ManagerCustomMock{
+				CertMock: func(kid, realm string) (*cert.Cert, error) {
+					return &cert.Cert{Kid: kid}, tt.certErr
+				},
+				PublicKeyMock: func(cert *cert.Cert) (*rsa.PublicKey, error) {
+					return pub, nil
+				},
+			}
+			j := NewJwtDecoder(certManager, append(tt.opts, WithRecorder(recorder))...)
+			_, _ = j.DecodeAccessTokenClaims(tt.token, "test", jwt.MapClaims{})
+			if len(outcomes) != 1 || outcomes[0] != "test/"+tt.wantOutcome {
+				t.Errorf("outcomes = %v, want [test/%s]", outcomes, tt.wantOutcome)
+			}
+		})
+	}
+}
+
+func Test_jwtDecoder_RecorderKeyCache(t *testing.T) {
+	pk, pub, _ := generateKeys()
+	var hits []bool
+	recorder := metrics.RecorderCustomMock{
+		KeyCacheLookupMock: func(realm string, hit bool) {
+			hits = append(hits, hit)
+		},
+	}
+	certManager := cert.ManagerCustomMock{
+		CertMock: func(kid, realm string) (*cert.Cert, error) {
+			return &cert.Cert{Kid: kid}, nil
+		},
+		PublicKeyMock: func(cert *cert.Cert) (*rsa.PublicKey, error) {
+			return pub, nil
+		},
+	}
+	j := NewJwtDecoder(certManager, WithRecorder(recorder))
+	token := generateToken(pk, "Can be anything", time.Minute)
+	for i := 0; i < 2; i++ {
+		if _, err := j.DecodeAccessTokenClaims(token, "test", jwt.MapClaims{}); err != nil {
+			t.Fatalf("DecodeAccessTokenClaims() error = %v", err)
+		}
+	}
+	if len(hits) != 2 || hits[0] || !hits[1] {
+		t.Errorf("lookups = %v, want [false true]", hits)
+	}
+}
@@ -0,0 +1,227 @@
+package decoder
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"errors"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/marcosgmgm/openid-decode-token/pkg/cert"
+	"github.com/marcosgmgm/openid-decode-token/pkg/metrics"
+	"github.com/marcosgmgm/openid-decode-token/pkg/oidctest"
+)
+
+func Test_jwtDecoder_Provider(t *testing.T) {
+	p := oidctest.NewProvider("first", "second")
+	defer p.Close()
+	j := NewJwtDecoder(p.Manager())
+	first, _ := p.Realm("first").Token(jwt.MapClaims{"sub": "user"})
+	second, _ := p.Realm("second").Token(jwt.MapClaims{"sub": "user"})
+
+	for _, tc := range []struct {
+		token, realm string
+		wantErr      bool
+	}{
+		{token: first, realm: "first"},
+		{token: second, realm: "second"},
+		// The key of "second" is cached by now, it must not verify tokens
+		// presented for "first".
+		{token: second, realm: "first", wantErr: true},
+	} {
+		if _, err := j.DecodeAccessTokenClaims(tc.token, tc.realm, jwt.MapClaims{}); (err != nil) != tc.wantErr {
+			t.Errorf("DecodeAccessTokenClaims(%s) error = %v, wantErr %v", tc.realm, err, tc.wantErr)
+		}
+	}
+	// The unknown kid does not refresh the key set of "first", fetched just
+	// before.
+	if discovery, keys := p.Realm("first").Requests(); discovery != 1 || keys != 1 {
+		t.Errorf("requests to first = %d, %d, want 1, 1", discovery, keys)
+	}
+}
+
+func Test_jwtDecoder_ProviderAlgorithms(t *testing.T) {
+	p := oidctest.NewProvider("test")
+	defer p.Close()
+	realm := p.Realm("test")
+	for _, alg := range []string{"RS256", "RS384", "RS512", "ES256", "ES384", "ES512"} {
+		t.Run(alg, func(t *testing.T) {
+			if _, err := realm.Rotate(alg); err != nil {
+				t.Fatalf("Rotate() error = %v", err)
+			}
+			token, _ := realm.Token(jwt.MapClaims{"sub": "user"})
+			j := NewJwtDecoder(p.Manager(), WithAlgorithms(alg))
+			if _, err := j.DecodeAccessTokenClaims(token, "test", jwt.MapClaims{}); err != nil {
+				t.Errorf("DecodeAccessTokenClaims() error = %v", err)
+			}
+		})
+	}
+}
+
+func Test_jwtDecoder_KeyPolicy(t *testing.T) {
+	p := oidctest.NewProvider("test")
+	defer p.Close()
+	realm := p.Realm("test")
+	ec, _ := realm.Rotate("ES384")
+	weakSigner, _ := rsa.GenerateKey(rand.Reader, 1024)
+	weak, _ := oidctest.NewKeyFromSigner("RS256", weakSigner)
+	realm.AddKey(weak)
+	p256, _ := oidctest.NewKey("ES256")
+	var outcomes []string
+	recorder := WithRecorder(metrics.RecorderCustomMock{
+		TokenValidatedMock: func(realm, outcome string) { outcomes = append(outcomes, outcome) },
+	})
+	j := NewJwtDecoder(p.Manager(), recorder, WithAlgorithms("RS256", "ES256", "ES384"))
+
+	for _, token := range []string{
+		oidctest.NewToken(ec).Issuer(realm.Issuer()).MustSign(),
+		oidctest.NewToken(weak).Issuer(realm.Issuer()).MustSign(),
+		// An ES256 signature cannot come from a P-384 key.
+		oidctest.NewToken(p256).Issuer(realm.Issuer()).Kid(ec.Kid).MustSign(),
+	} {
+		_, _ = j.DecodeAccessTokenClaims(token, "test", jwt.MapClaims{})
+	}
+	// EC signatures are only verified when enabled.
+	token := oidctest.NewToken(ec).Issuer(realm.Issuer()).MustSign()
+	_, _ = NewJwtDecoder(p.Manager(), recorder).DecodeAccessTokenClaims(token, "test", jwt.MapClaims{})
+	want := []string{metrics.OutcomeValid, metrics.OutcomeKeyRejected, metrics.OutcomeInvalidAlgorithm, metrics.OutcomeInvalidAlgorithm}
+	if !reflect.DeepEqual(outcomes, want) {
+		t.Errorf("outcomes = %v, want %v", outcomes, want)
+	}
+}
+
+func Test_jwtDecoder_KidlessToken(t *testing.T) {
+	p := oidctest.NewProvider("test")
+	defer p.Close()
+	realm := p.Realm("test")
+	first := realm.SigningKey()
+	second, _ := realm.Rotate("RS256")
+	ec, _ := realm.Rotate("ES256")
+	unpublished, _ := oidctest.NewKey("RS256")
+	j := NewJwtDecoder(p.Manager(), WithKidlessFallback(), WithAlgorithms("RS256", "RS512", "ES256"))
+
+	tests := []struct {
+		name        string
+		token       string
+		wantOutcome string
+	}{
+		{name: "first key", token: oidctest.NewToken(first).Issuer(realm.Issuer()).Header("kid", nil).MustSign(), wantOutcome: metrics.OutcomeValid},
+		{name: "second key", token: oidctest.NewToken(second).Issuer(realm.Issuer()).Header("kid", nil).MustSign(), wantOutcome: metrics.OutcomeValid},
+		{name: "EC key", token: oidctest.NewToken(ec).Issuer(realm.Issuer()).Header("kid", nil).MustSign(), wantOutcome: metrics.OutcomeValid},
+		{name: "expired", token: oidctest.NewToken(second).Issuer(realm.Issuer()).ExpiresIn(-time.Minute).Header("kid", nil).MustSign(), wantOutcome: metrics.OutcomeExpired},
+		{name: "unpublished key", token: oidctest.NewToken(unpublished).Issuer(realm.Issuer()).Header("kid", nil).MustSign(), wantOutcome: metrics.OutcomeInvalidSignature},
+		{name: "no key for the algorithm", token: oidctest.NewToken(first).Issuer(realm.Issuer()).Alg("RS512").Header("kid", nil).MustSign(), wantOutcome: metrics.OutcomeKeyUnavailable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := j.DecodeAccessTokenClaims(tt.token, "test", jwt.MapClaims{})
+			if got := Outcome(err); got != tt.wantOutcome {
+				t.Errorf("DecodeAccessTokenClaims() outcome = %s, want %s: %v", got, tt.wantOutcome, err)
+			}
+			var ve *jwt.ValidationError
+			if tt.wantOutcome == metrics.OutcomeKeyUnavailable && !(errors.As(err, &ve) && errors.Is(ve.Inner, ErrNoMatchingKey)) {
+				t.Errorf("DecodeAccessTokenClaims() error = %v, want ErrNoMatchingKey", err)
+			}
+		})
+	}
+}
+
+func Test_jwtDecoder_KidlessCandidateLimit(t *testing.T) {
+	p := oidctest.NewProvider("test")
+	defer p.Close()
+	realm := p.Realm("test")
+	signing := realm.SigningKey()
+	for i := 1; i < maxKidlessCandidates; i++ {
+		_, _ = realm.Rotate("RS256")
+	}
+	ec, _ := realm.Rotate("ES256")
+	j := NewJwtDecoder(p.Manager(cert.WithKeySetTTL(0)), WithKidlessFallback())
+	token := func() string {
+		return oidctest.NewToken(signing).Issuer(realm.Issuer()).Header("kid", nil).MustSign()
+	}
+	// The EC key is no candidate for RS256 tokens.
+	if _, err := j.DecodeAccessTokenClaims(token(), "test", jwt.MapClaims{}); err != nil {
+		t.Fatalf("DecodeAccessTokenClaims() error = %v with %d RSA keys", err, maxKidlessCandidates)
+	}
+	realm.RemoveKey(ec.Kid)
+	_, _ = realm.Rotate("RS256")
+	_, err := j.DecodeAccessTokenClaims(token(), "test", jwt.MapClaims{})
+	var ve *jwt.ValidationError
+	if !errors.As(err, &ve) || !errors.Is(ve.Inner, ErrNoMatchingKey) {
+		t.Errorf("DecodeAccessTokenClaims() error = %v, want ErrNoMatchingKey", err)
+	}
+}
+
+func Test_jwtDecoder_RemovedKey(t *testing.T) {
+	p := oidctest.NewProvider("test")
+	defer p.Close()
+	realm := p.Realm("test")
+	removed := realm.SigningKey()
+	_, _ = realm.Rotate("RS256")
+	j := NewJwtDecoder(p.Manager(cert.WithKeySetTTL(0)), WithKeyCacheTTL(50*time.Millisecond))
+	token := oidctest.NewToken(removed).Issuer(realm.Issuer()).MustSign()
+	if _, err := j.DecodeAccessTokenClaims(token, "test", jwt.MapClaims{}); err != nil {
+		t.Fatalf("DecodeAccessTokenClaims() error = %v", err)
+	}
+
+	realm.RemoveKey(removed.Kid)
+	if _, err := j.DecodeAccessTokenClaims(token, "test", jwt.MapClaims{}); err != nil {
+		t.Errorf("DecodeAccessTokenClaims() error = %v while the key is cached", err)
+	}
+	time.Sleep(60 * time.Millisecond)
+	_, err := j.DecodeAccessTokenClaims(token, "test", jwt.MapClaims{})
+	if got := Outcome(err); got != metrics.OutcomeKeyUnavailable {
+		t.Errorf("DecodeAccessTokenClaims() outcome = %s, want %s: %v", got, metrics.OutcomeKeyUnavailable, err)
+	}
+}
+
+// certOnlyManager hides the KeySet method of the manager it wraps, like a
+// manager implemented outside of the cert package.
+type certOnlyManager struct {
+	manager cert.Manager
+}
+
+func (m certOnlyManager) Cert(kid, realm string) (*cert.Cert, error) {
+	return m.manager.Cert(kid, realm)
+}
+
+func (m certOnlyManager) PublicKey(c *cert.Cert) (*rsa.PublicKey, error) {
+	return m.manager.PublicKey(c)
+}
+
+func Test_jwtDecoder_KidlessWithoutKeySet(t *testing.T) {
+	p := oidctest.NewProvider("test")
+	defer p.Close()
+	realm := p.Realm("test")
+	j := NewJwtDecoder(certOnlyManager{p.Manager()}, WithKidlessFallback())
+
+	token := oidctest.NewToken(realm.SigningKey()).Issuer(realm.Issuer())
+	if _, err := j.DecodeAccessTokenClaims(token.MustSign(), "test", jwt.MapClaims{}); err != nil {
+		t.Fatalf("DecodeAccessTokenClaims() error = %v", err)
+	}
+	_, err := j.DecodeAccessTokenClaims(token.Header("kid", nil).MustSign(), "test", jwt.MapClaims{})
+	var ve *jwt.ValidationError
+	if !errors.As(err, &ve) || !errors.Is(ve.Inner, ErrNoMatchingKey) {
+		t.Errorf("DecodeAccessTokenClaims() error = %v, want ErrNoMatchingKey", err)
+	}
+}
+
+func Test_jwtDecoder_JWKSGateway(t *testing.T) {
+	p := oidctest.NewProvider("test")
+	defer p.Close()
+	gateway := httptest.NewTLSServer(cert.NewJWKSHandler(p.Manager(), "test"))
+	defer gateway.Close()
+	downstream := cert.NewCertManager(gateway.URL, gateway.Client(), cert.WithJWKSURI(gateway.URL+"/certs"))
+	j := NewJwtDecoder(downstream)
+
+	token, _ := p.Realm("test").Token(jwt.MapClaims{"sub": "user"})
+	if _, err := j.DecodeAccessTokenClaims(token, "test", jwt.MapClaims{}); err != nil {
+		t.Fatalf("DecodeAccessTokenClaims() error = %v", err)
+	}
+	if discovery, keys := p.Realm("test").Requests(); discovery != 1 || keys != 1 {
+		t.Errorf("requests to the identity provider = %d, %d, want 1, 1", discovery, keys)
+	}
+}
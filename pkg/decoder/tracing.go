@@ -0,0 +1,28 @@
+package decoder
+
+import (
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const instrumentationName = "github.com/marcosgmgm/openid-decode-token/pkg/decoder"
+
+// Span attributes.
+const (
+	attrRealm    = attribute.Key("openid.realm")
+	attrKid      = attribute.Key("openid.kid")
+	attrAlg      = attribute.Key("openid.alg")
+	attrCacheHit = attribute.Key("openid.cache_hit")
+	attrOutcome  = attribute.Key("openid.outcome")
+	// attrCandidates is the number of keys tried for a token without a kid.
+	attrCandidates = attribute.Key("openid.candidate_keys")
+)
+
+// WithTracerProvider records a span for every decoded token. When the
+// manager implements cert.ContextManager its key lookups are children of
+// that span.
+func WithTracerProvider(tp trace.TracerProvider) Option {
+	return func(s *settings) {
+		s.tracer = tp.Tracer(instrumentationName)
+	}
+}
@@ -0,0 +1,77 @@
+package decoder
+
+import (
+	"context"
+	"crypto/rsa"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/marcosgmgm/openid-decode-token/pkg/cert"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// contextManagerMock is a cert.ContextManager recording the span found in
+// the context of each lookup.
+type contextManagerMock struct {
+	cert.ManagerCustomMock
+	spans *[]trace.SpanContext
+}
+
+func (m contextManagerMock) CertContext(ctx context.Context, kid, realm string) (*cert.Cert, error) {
+	*m.spans = append(*m.spans, trace.SpanContextFromContext(ctx))
+	return m.Cert(kid, realm)
+}
+
+func Test_jwtDecoder_Tracing(t *testing.T) {
+	pk, pub, _ := generateKeys()
+	spans := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(spans))
+	var lookups []trace.SpanContext
+	certManager := contextManagerMock{
+		ManagerCustomMock: cert.ManagerCustomMock{
+			CertMock: func(kid, realm string) (*cert.Cert, error) {
+				return &cert.Cert{Kid: kid}, nil
+			},
+			PublicKeyMock: func(cert *cert.Cert) (*rsa.PublicKey, error) {
+				return pub, nil
+			},
+		},
+		spans: &lookups,
+	}
+	j := NewJwtDecoder(certManager, WithTracerProvider(tp)).(ContextDecoder)
+	token := generateToken(pk, "Can be anything", time.Minute)
+	for i := 0; i < 2; i++ {
+		if _, err := j.DecodeAccessTokenClaimsContext(context.Background(), token, "test", jwt.MapClaims{}); err != nil {
+			t.Fatalf("DecodeAccessTokenClaimsContext() error = %v", err)
+		}
+	}
+
+	ended := spans.Ended()
+	if len(ended) != 2 {
+		t.Fatalf("spans = %d, want 2", len(ended))
+	}
+	if len(lookups) != 1 || lookups[0].SpanID() != ended[0].SpanContext().SpanID() {
+		t.Errorf("key lookup not parented to the decode span")
+	}
+	for i, wantHit := range []string{"false", "true"} {
+		attrs := make(map[string]string)
+		for _, kv := range ended[i].Attributes() {
+			attrs[string(kv.Key)] = kv.Value.Emit()
+		}
+		want := map[string]string{
+			"openid.realm":     "test",
+			"openid.kid":       "kid",
+			"openid.alg":       "RS256",
+			"openid.cache_hit": wantHit,
+			"openid.outcome":   "valid",
+		}
+		for k, v := range want {
+			if attrs[k] != v {
+				t.Errorf("span %d attribute %s = %q, want %q", i, k, attrs[k], v)
+			}
+		}
+	}
+}
@@ -0,0 +1,67 @@
+// Package metrics defines the instrumentation hooks of the cert manager and
+// the decoder. The prometheus subpackage adapts them to Prometheus.
+package metrics
+
+import "time"
+
+// Outcomes of a token validation.
+const (
+	OutcomeValid             = "valid"
+	OutcomeMalformed         = "malformed"
+	OutcomeExpired           = "expired"
+	OutcomeNotYetValid       = "not_yet_valid"
+	OutcomeInvalidClaims     = "invalid_claims"
+	OutcomeInvalidSignature  = "invalid_signature"
+	OutcomeInvalidAlgorithm  = "invalid_algorithm"
+	OutcomeInvalidAudience   = "invalid_audience"
+	OutcomeInvalidDelegation = "invalid_delegation"
+	OutcomeUnknownIssuer     = "unknown_issuer"
+	OutcomeKeyUnavailable    = "key_unavailable"
+	OutcomeKeyRejected       = "key_rejected"
+	OutcomeDecryptionFailed  = "decryption_failed"
+)
+
+// RealmUnknown is the realm reported for tokens a multi-issuer decoder rejects
+// before their issuer is known.
+const RealmUnknown = "unknown"
+
+// Documents fetched from the identity provider.
+const (
+	DocumentConfiguration = "configuration"
+	DocumentKeys          = "keys"
+)
+
+// Reasons a key is rejected by the key policy of the cert manager.
+const (
+	RejectionWeakRSAKey      = "weak_rsa_key"
+	RejectionCurveNotAllowed = "curve_not_allowed"
+	RejectionKeyType         = "key_type"
+)
+
+// Recorder receives the events worth counting. Implementations must be safe
+// for concurrent use.
+type Recorder interface {
+	// TokenValidated is called once per decoded token with one of the
+	// Outcome constants.
+	TokenValidated(realm, outcome string)
+	// KeyCacheLookup is called when the decoder looks up the key of a kid.
+	KeyCacheLookup(realm string, hit bool)
+	// DocumentFetched is called after each request to the identity provider.
+	// statusCode is 0 when no response was received.
+	DocumentFetched(realm, document string, statusCode int, elapsed time.Duration)
+	// CachedKeys is called with the size of the key set of a realm whenever
+	// it is refreshed.
+	CachedKeys(realm string, n int)
+	// KeyRejected is called with one of the Rejection constants for each
+	// key of a refreshed key set that does not satisfy the key policy.
+	KeyRejected(realm, reason string)
+}
+
+// Nop discards every event.
+type Nop struct{}
+
+func (Nop) TokenValidated(realm, outcome string)                                          {}
+func (Nop) KeyCacheLookup(realm string, hit bool)                                         {}
+func (Nop) DocumentFetched(realm, document string, statusCode int, elapsed time.Duration) {}
+func (Nop) CachedKeys(realm string, n int)                                                {}
+func (Nop) KeyRejected(realm, reason string)                                              {}
@@ -0,0 +1,43 @@
+package metrics
+
+import "time"
+
+// RecorderCustomMock forwards the events to the functions that are set and
+// drops the others.
+type RecorderCustomMock struct {
+	TokenValidatedMock  func(realm, outcome string)
+	KeyCacheLookupMock  func(realm string, hit bool)
+	DocumentFetchedMock func(realm, document string, statusCode int, elapsed time.Duration)
+	CachedKeysMock      func(realm string, n int)
+	KeyRejectedMock     func(realm, reason string)
+}
+
+func (r RecorderCustomMock) TokenValidated(realm, outcome string) {
+	if r.TokenValidatedMock != nil {
+		r.TokenValidatedMock(realm, outcome)
+	}
+}
+
+func (r RecorderCustomMock) KeyCacheLookup(realm string, hit bool) {
+	if r.KeyCacheLookupMock != nil {
+		r.KeyCacheLookupMock(realm, hit)
+	}
+}
+
+func (r RecorderCustomMock) DocumentFetched(realm, document string, statusCode int, elapsed time.Duration) {
+	if r.DocumentFetchedMock != nil {
+		r.DocumentFetchedMock(realm, document, statusCode, elapsed)
+	}
+}
+
+func (r RecorderCustomMock) CachedKeys(realm string, n int) {
+	if r.CachedKeysMock != nil {
+		r.CachedKeysMock(realm, n)
+	}
+}
+
+func (r RecorderCustomMock) KeyRejected(realm, reason string) {
+	if r.KeyRejectedMock != nil {
+		r.KeyRejectedMock(realm, reason)
+	}
+}
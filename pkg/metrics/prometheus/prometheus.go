@@ -0,0 +1,100 @@
+// Package prometheus exports the events of metrics.Recorder as Prometheus
+// metrics.
+package prometheus
+
+import (
+	"strconv"
+	"time"
+
+	prom "github.com/prometheus/client_golang/prometheus"
+
+	"github.com/marcosgmgm/openid-decode-token/pkg/metrics"
+)
+
+// Recorder is a metrics.Recorder backed by Prometheus collectors.
+type Recorder struct {
+	validations   *prom.CounterVec
+	cacheLookups  *prom.CounterVec
+	fetches       *prom.CounterVec
+	fetchDuration *prom.HistogramVec
+	cachedKeys    *prom.GaugeVec
+	rejectedKeys  *prom.CounterVec
+}
+
+var _ metrics.Recorder = (*Recorder)(nil)
+
+// New registers the collectors on reg, prefixed with namespace when it is not
+// empty:
+//
+//	token_validations_total{realm,outcome}
+//	key_cache_lookups_total{realm,result}
+//	document_fetches_total{realm,document,code}
+//	document_fetch_duration_seconds{realm,document}
+//	cached_keys{realm}
+//	key_rejections_total{realm,reason}
+func New(reg prom.Registerer, namespace string) (*Recorder, error) {
+	r := &Recorder{
+		validations: prom.NewCounterVec(prom.CounterOpts{
+			Namespace: namespace,
+			Name:      "token_validations_total",
+			Help:      "Decoded tokens by outcome.",
+		}, []string{"realm", "outcome"}),
+		cacheLookups: prom.NewCounterVec(prom.CounterOpts{
+			Namespace: namespace,
+			Name:      "key_cache_lookups_total",
+			Help:      "Key lookups of the decoder by result, hit or miss.",
+		}, []string{"realm", "result"}),
+		fetches: prom.NewCounterVec(prom.CounterOpts{
+			Namespace: namespace,
+			Name:      "document_fetches_total",
+			Help:      "Requests to the identity provider by document and status code, 0 when no response was received.",
+		}, []string{"realm", "document", "code"}),
+		fetchDuration: prom.NewHistogramVec(prom.HistogramOpts{
+			Namespace: namespace,
+			Name:      "document_fetch_duration_seconds",
+			Help:      "Latency of the requests to the identity provider.",
+			Buckets:   prom.DefBuckets,
+		}, []string{"realm", "document"}),
+		cachedKeys: prom.NewGaugeVec(prom.GaugeOpts{
+			Namespace: namespace,
+			Name:      "cached_keys",
+			Help:      "Keys in the last key set fetched.",
+		}, []string{"realm"}),
+		rejectedKeys: prom.NewCounterVec(prom.CounterOpts{
+			Namespace: namespace,
+			Name:      "key_rejections_total",
+			Help:      "Published keys rejected by the key policy on key set refreshes, by reason.",
+		}, []string{"realm", "reason"}),
+	}
+	for _, c := range []prom.Collector{r.validations, r.cacheLookups, r.fetches, r.fetchDuration, r.cachedKeys, r.rejectedKeys} {
+		if err := reg.Register(c); err != nil {
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+func (r *Recorder) TokenValidated(realm, outcome string) {
+	r.validations.WithLabelValues(realm, outcome).Inc()
+}
+
+func (r *Recorder) KeyCacheLookup(realm string, hit bool) {
+	result := "miss"
+	if hit {
+		result = "hit"
+	}
+	r.cacheLookups.WithLabelValues(realm, result).Inc()
+}
+
+func (r *Recorder) DocumentFetched(realm, document string, statusCode int, elapsed time.Duration) {
+	r.fetches.WithLabelValues(realm, document, strconv.Itoa(statusCode)).Inc()
+	r.fetchDuration.WithLabelValues(realm, document).Observe(elapsed.Seconds())
+}
+
+func (r *Recorder) CachedKeys(realm string, n int) {
+	r.cachedKeys.WithLabelValues(realm).Set(float64(n))
+}
+
+func (r *Recorder) KeyRejected(realm, reason string) {
+	r.rejectedKeys.WithLabelValues(realm, reason).Inc()
+}
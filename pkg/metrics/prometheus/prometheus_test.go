@@ -0,0 +1,60 @@
+package prometheus
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	prom "github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/marcosgmgm/openid-decode-token/pkg/metrics"
+)
+
+func TestRecorder(t *testing.T) {
+	reg := prom.NewPedanticRegistry()
+	r, err := New(reg, "openid")
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	r.TokenValidated("test", metrics.OutcomeValid)
+	r.TokenValidated("test", metrics.OutcomeValid)
+	r.TokenValidated("test", metrics.OutcomeExpired)
+	r.KeyCacheLookup("test", false)
+	r.KeyCacheLookup("test", true)
+	r.DocumentFetched("test", metrics.DocumentKeys, 200, 20*time.Millisecond)
+	r.DocumentFetched("test", metrics.DocumentKeys, 0, time.Second)
+	r.CachedKeys("test", 3)
+	r.KeyRejected("test", metrics.RejectionWeakRSAKey)
+
+	want := `
+# HELP openid_cached_keys Keys in the last key set fetched.
+# TYPE openid_cached_keys gauge
+openid_cached_keys{realm="test"} 3
+# HELP openid_document_fetches_total Requests to the identity provider by document and status code, 0 when no response was received.
+# TYPE openid_document_fetches_total counter
+openid_document_fetches_total{code="0",document="keys",realm="test"} 1
+openid_document_fetches_total{code="200",document="keys",realm="test"} 1
+# HELP openid_key_cache_lookups_total Key lookups of the decoder by result, hit or miss.
+# TYPE openid_key_cache_lookups_total counter
+openid_key_cache_lookups_total{realm="test",result="hit"} 1
+openid_key_cache_lookups_total{realm="test",result="miss"} 1
+# HELP openid_key_rejections_total Published keys rejected by the key policy on key set refreshes, by reason.
+# TYPE openid_key_rejections_total counter
+openid_key_rejections_total{realm="test",reason="weak_rsa_key"} 1
+# HELP openid_token_validations_total Decoded tokens by outcome.
+# TYPE openid_token_validations_total counter
+openid_token_validations_total{outcome="expired",realm="test"} 1
+openid_token_validations_total{outcome="valid",realm="test"} 2
+`
+	names := []string{"openid_cached_keys", "openid_document_fetches_total", "openid_key_cache_lookups_total", "openid_key_rejections_total", "openid_token_validations_total"}
+	if err := testutil.GatherAndCompare(reg, strings.NewReader(want), names...); err != nil {
+		t.Error(err)
+	}
+	if n := testutil.CollectAndCount(r.fetchDuration); n != 1 {
+		t.Errorf("duration series = %d, want 1", n)
+	}
+	if _, err = New(reg, "openid"); err == nil {
+		t.Error("New() registered the collectors twice")
+	}
+}
@@ -0,0 +1,106 @@
+package oidctest
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/marcosgmgm/openid-decode-token/pkg/cert"
+)
+
+var ErrUnsupportedAlgorithm = errors.New("unsupported signature algorithm")
+
+// Key is a signing key of a realm.
+type Key struct {
+	Kid    string
+	Alg    string
+	Signer crypto.Signer
+	method jwt.SigningMethod
+}
+
+// NewKey generates a key for alg: RS256, RS384, RS512, ES256, ES384 or ES512,
+// the algorithms the decoder verifies. The kid is the RFC 7638 thumbprint of
+// the key.
+func NewKey(alg string) (*Key, error) {
+	var (
+		signer crypto.Signer
+		err    error
+	)
+	switch alg {
+	case "RS256", "RS384", "RS512":
+		signer, err = rsa.GenerateKey(rand.Reader, 2048)
+	case "ES256":
+		signer, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case "ES384":
+		signer, err = ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	case "ES512":
+		signer, err = ecdsa.GenerateKey(elliptic.P521(), rand.Reader)
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrUnsupportedAlgorithm, alg)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return NewKeyFromSigner(alg, signer)
+}
+
+// NewKeyFromSigner wraps an existing private key, for example one whose size
+// is not the default.
+func NewKeyFromSigner(alg string, signer crypto.Signer) (*Key, error) {
+	k := &Key{Alg: alg, Signer: signer}
+	switch m := jwt.GetSigningMethod(alg).(type) {
+	case *jwt.SigningMethodRSA, *jwt.SigningMethodECDSA:
+		k.method = m
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrUnsupportedAlgorithm, alg)
+	}
+	c, err := k.jwk()
+	if err != nil {
+		return nil, err
+	}
+	if k.Kid, err = c.Thumbprint(); err != nil {
+		return nil, err
+	}
+	return k, nil
+}
+
+// Public returns the public JWK of the key.
+func (k *Key) Public() cert.Cert {
+	c, _ := k.jwk()
+	c.Kid = k.Kid
+	return c
+}
+
+func (k *Key) jwk() (cert.Cert, error) {
+	c := cert.Cert{Use: "sig", Alg: k.Alg}
+	switch pub := k.Signer.Public().(type) {
+	case *rsa.PublicKey:
+		c.Kty = "RSA"
+		c.N = base64.RawURLEncoding.EncodeToString(pub.N.Bytes())
+		c.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes())
+	case *ecdsa.PublicKey:
+		size := (pub.Curve.Params().BitSize + 7) / 8
+		c.Kty = "EC"
+		c.Crv = pub.Curve.Params().Name
+		c.X = base64.RawURLEncoding.EncodeToString(pub.X.FillBytes(make([]byte, size)))
+		c.Y = base64.RawURLEncoding.EncodeToString(pub.Y.FillBytes(make([]byte, size)))
+	default:
+		return c, fmt.Errorf("%w: %T", ErrUnsupportedAlgorithm, pub)
+	}
+	return c, nil
+}
+
+// Sign returns the compact serialization of claims signed by the key, with
+// the kid in the header.
+func (k *Key) Sign(claims jwt.Claims) (string, error) {
+	t := jwt.NewWithClaims(k.method, claims)
+	t.Header["kid"] = k.Kid
+	return t.SignedString(k.Signer)
+}
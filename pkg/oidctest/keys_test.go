@@ -0,0 +1,40 @@
+package oidctest
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+func TestNewKey(t *testing.T) {
+	for _, alg := range []string{"RS256", "RS384", "RS512", "ES256", "ES384", "ES512"} {
+		t.Run(alg, func(t *testing.T) {
+			k, err := NewKey(alg)
+			if err != nil {
+				t.Fatalf("NewKey() error = %v", err)
+			}
+			jwk := k.Public()
+			if tp, _ := jwk.Thumbprint(); jwk.Kid != k.Kid || tp != k.Kid {
+				t.Errorf("kid = %s, thumbprint %s", jwk.Kid, tp)
+			}
+			token, err := k.Sign(jwt.MapClaims{"sub": "user"})
+			if err != nil {
+				t.Fatalf("Sign() error = %v", err)
+			}
+			parser := jwt.Parser{SkipClaimsValidation: true}
+			_, err = parser.Parse(token, func(t *jwt.Token) (interface{}, error) {
+				return k.Signer.Public(), nil
+			})
+			if err != nil {
+				t.Errorf("Parse() error = %v", err)
+			}
+		})
+	}
+	// The decoder verifies neither RSA-PSS nor EdDSA signatures.
+	for _, alg := range []string{"HS256", "PS256", "EdDSA"} {
+		if _, err := NewKey(alg); !errors.Is(err, ErrUnsupportedAlgorithm) {
+			t.Errorf("NewKey(%s) error = %v, want %v", alg, err, ErrUnsupportedAlgorithm)
+		}
+	}
+}
@@ -0,0 +1,243 @@
+// Package oidctest runs an in-process OpenID Provider for tests. It serves
+// discovery and JWKS documents for any number of realms with the Keycloak
+// layout, mints tokens signed with RSA or EC keys, and can rotate
+// keys, slow down or fail its responses.
+package oidctest
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/marcosgmgm/openid-decode-token/pkg/cert"
+)
+
+const (
+	discoveryPath = "/.well-known/openid-configuration"
+	keysPath      = "/protocol/openid-connect/certs"
+	defaultTTL    = 5 * time.Minute
+)
+
+// Provider is a fake OpenID Provider listening on a local TLS server.
+type Provider struct {
+	server   *httptest.Server
+	mu       sync.Mutex
+	realms   map[string]*Realm
+	delay    time.Duration
+	failures []int
+}
+
+// NewProvider starts a provider with the given realms, each with an RS256
+// signing key. Close it at the end of the test.
+func NewProvider(realms ...string) *Provider {
+	p := &Provider{realms: make(map[string]*Realm)}
+	p.server = httptest.NewTLSServer(http.HandlerFunc(p.serveHTTP))
+	for _, name := range realms {
+		p.Realm(name)
+	}
+	return p
+}
+
+// Close shuts the server down.
+func (p *Provider) Close() {
+	p.server.Close()
+}
+
+// URL is the base path to give to cert.NewCertManager.
+func (p *Provider) URL() string {
+	return p.server.URL
+}
+
+// Client trusts the certificate of the server.
+func (p *Provider) Client() *http.Client {
+	return p.server.Client()
+}
+
+// Manager returns a cert manager reading the keys of the provider.
+func (p *Provider) Manager(opts ...cert.Option) cert.Manager {
+	return cert.NewCertManager(p.URL(), p.Client(), opts...)
+}
+
+// Realm returns the realm called name, creating it with an RS256 signing key
+// when it does not exist.
+func (p *Provider) Realm(name string) *Realm {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if r, ok := p.realms[name]; ok {
+		return r
+	}
+	k, err := NewKey("RS256")
+	if err != nil {
+		panic(err)
+	}
+	r := &Realm{p: p, name: name, keys: []*Key{k}, signing: k}
+	p.realms[name] = r
+	return r
+}
+
+// SetDelay makes every response wait d, or until the request is canceled.
+func (p *Provider) SetDelay(d time.Duration) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.delay = d
+}
+
+// FailNext answers the next n requests with status and no body.
+func (p *Provider) FailNext(n, status int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for i := 0; i < n; i++ {
+		p.failures = append(p.failures, status)
+	}
+}
+
+func (p *Provider) serveHTTP(w http.ResponseWriter, req *http.Request) {
+	p.mu.Lock()
+	delay := p.delay
+	var status int
+	if len(p.failures) > 0 {
+		status, p.failures = p.failures[0], p.failures[1:]
+	}
+	var (
+		r    *Realm
+		body interface{}
+	)
+	path := strings.TrimPrefix(req.URL.Path, "/")
+	if i := strings.Index(path, "/"); i > 0 {
+		r = p.realms[path[:i]]
+	}
+	switch {
+	case r == nil:
+	case strings.HasSuffix(path, discoveryPath):
+		r.discoveryRequests++
+		body = map[string]interface{}{
+			"issuer":                                r.Issuer(),
+			"jwks_uri":                              r.Issuer() + keysPath,
+			"id_token_signing_alg_values_supported": r.algorithms(),
+		}
+	case strings.HasSuffix(path, keysPath):
+		r.keysRequests++
+		keys := make([]cert.Cert, 0, len(r.keys))
+		for _, k := range r.keys {
+			keys = append(keys, k.Public())
+		}
+		body = map[string]interface{}{"keys": keys}
+	}
+	p.mu.Unlock()
+
+	if delay > 0 {
+		select {
+		case <-time.After(delay):
+		case <-req.Context().Done():
+			return
+		}
+	}
+	switch {
+	case status != 0:
+		w.WriteHeader(status)
+	case body == nil:
+		http.NotFound(w, req)
+	default:
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(body)
+	}
+}
+
+// Realm is a realm of a Provider: an issuer with its own keys.
+type Realm struct {
+	p                 *Provider
+	name              string
+	keys              []*Key
+	signing           *Key
+	discoveryRequests int
+	keysRequests      int
+}
+
+// Name is the realm to pass to the decoder.
+func (r *Realm) Name() string {
+	return r.name
+}
+
+// Issuer is the "iss" of the tokens of the realm.
+func (r *Realm) Issuer() string {
+	return r.p.URL() + "/" + r.name
+}
+
+func (r *Realm) algorithms() []string {
+	var algs []string
+	seen := make(map[string]bool)
+	for _, k := range r.keys {
+		if !seen[k.Alg] {
+			seen[k.Alg] = true
+			algs = append(algs, k.Alg)
+		}
+	}
+	return algs
+}
+
+// SigningKey is the key Token signs with.
+func (r *Realm) SigningKey() *Key {
+	r.p.mu.Lock()
+	defer r.p.mu.Unlock()
+	return r.signing
+}
+
+// Keys returns the published keys.
+func (r *Realm) Keys() []*Key {
+	r.p.mu.Lock()
+	defer r.p.mu.Unlock()
+	return append([]*Key(nil), r.keys...)
+}
+
+// AddKey publishes k without signing with it.
+func (r *Realm) AddKey(k *Key) {
+	r.p.mu.Lock()
+	defer r.p.mu.Unlock()
+	r.keys = append(r.keys, k)
+}
+
+// Rotate publishes a new key for alg and signs with it from now on. The
+// previous keys stay published until RemoveKey.
+func (r *Realm) Rotate(alg string) (*Key, error) {
+	k, err := NewKey(alg)
+	if err != nil {
+		return nil, err
+	}
+	r.p.mu.Lock()
+	defer r.p.mu.Unlock()
+	r.keys = append(r.keys, k)
+	r.signing = k
+	return k, nil
+}
+
+// RemoveKey stops publishing the key kid. Decoders that verified a token
+// signed with kid keep accepting its tokens until their key cache and the key
+// set of their manager expire, see decoder.WithKeyCacheTTL and
+// cert.WithKeySetTTL.
+func (r *Realm) RemoveKey(kid string) {
+	r.p.mu.Lock()
+	defer r.p.mu.Unlock()
+	for i, k := range r.keys {
+		if k.Kid == kid {
+			r.keys = append(r.keys[:i:i], r.keys[i+1:]...)
+			return
+		}
+	}
+}
+
+// Token signs claims with the signing key. "iss", "iat" and "exp" default to
+// the issuer of the realm, now and five minutes from now.
+func (r *Realm) Token(claims jwt.MapClaims) (string, error) {
+	return r.NewToken().Claims(claims).Sign()
+}
+
+// Requests returns how many discovery and JWKS requests the realm served.
+func (r *Realm) Requests() (discovery, keys int) {
+	r.p.mu.Lock()
+	defer r.p.mu.Unlock()
+	return r.discoveryRequests, r.keysRequests
+}
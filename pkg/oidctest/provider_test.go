@@ -0,0 +1,107 @@
+package oidctest
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/marcosgmgm/openid-decode-token/pkg/cert"
+	"github.com/marcosgmgm/openid-decode-token/pkg/decoder"
+)
+
+func TestProvider_Decode(t *testing.T) {
+	p := NewProvider("first", "second")
+	defer p.Close()
+	d := decoder.NewJwtDecoder(p.Manager())
+	for _, name := range []string{"first", "second"} {
+		r := p.Realm(name)
+		token, err := r.Token(jwt.MapClaims{"sub": "user"})
+		if err != nil {
+			t.Fatalf("Token() error = %v", err)
+		}
+		claims := jwt.MapClaims{}
+		if _, err = d.DecodeAccessTokenClaims(token, name, claims); err != nil {
+			t.Fatalf("DecodeAccessTokenClaims(%s) error = %v", name, err)
+		}
+		if claims["iss"] != r.Issuer() || claims["sub"] != "user" {
+			t.Errorf("claims = %v", claims)
+		}
+		if discovery, keys := r.Requests(); discovery != 1 || keys != 1 {
+			t.Errorf("requests = %d, %d, want 1, 1", discovery, keys)
+		}
+	}
+	other, _ := p.Realm("second").Token(nil)
+	if _, err := d.DecodeAccessTokenClaims(other, "first", jwt.MapClaims{}); err == nil {
+		t.Error("token of another realm accepted")
+	}
+}
+
+func TestRealm_Rotate(t *testing.T) {
+	p := NewProvider("test")
+	defer p.Close()
+	r := p.Realm("test")
+	old := r.SigningKey()
+	oldToken, _ := r.Token(nil)
+	k, err := r.Rotate("RS384")
+	if err != nil {
+		t.Fatalf("Rotate() error = %v", err)
+	}
+	newToken, _ := r.Token(nil)
+	if h := header(t, newToken); h["kid"] != k.Kid || h["alg"] != "RS384" {
+		t.Errorf("header after rotation = %v", h)
+	}
+
+	m := p.Manager(cert.WithKeySetTTL(0))
+	for _, token := range []string{oldToken, newToken} {
+		if _, err = m.Cert(header(t, token)["kid"].(string), "test"); err != nil {
+			t.Errorf("Cert() error = %v while both keys are published", err)
+		}
+	}
+	r.RemoveKey(old.Kid)
+	if _, err = m.Cert(old.Kid, "test"); err == nil {
+		t.Error("Cert() found a removed key")
+	}
+	if len(r.Keys()) != 1 {
+		t.Errorf("keys = %d, want 1", len(r.Keys()))
+	}
+}
+
+func TestProvider_Failures(t *testing.T) {
+	p := NewProvider("test")
+	defer p.Close()
+	kid := p.Realm("test").SigningKey().Kid
+
+	p.FailNext(1, http.StatusServiceUnavailable)
+	var se *cert.StatusError
+	if _, err := p.Manager().Cert(kid, "test"); !errors.As(err, &se) || se.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("Cert() error = %v, want 503", err)
+	}
+	if _, err := p.Manager().Cert(kid, "test"); err != nil {
+		t.Errorf("Cert() error = %v after the failure", err)
+	}
+
+	p.SetDelay(time.Second)
+	start := time.Now()
+	if _, err := p.Manager(cert.WithRequestTimeout(20*time.Millisecond)).Cert(kid, "test"); err == nil {
+		t.Error("Cert() succeeded despite the delay")
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("Cert() took %s, want the request timeout", elapsed)
+	}
+
+	p.SetDelay(0)
+	if _, err := p.Manager().Cert(kid, "unknown"); !errors.As(err, &se) || se.StatusCode != http.StatusNotFound {
+		t.Errorf("Cert() error = %v, want 404 for an unknown realm", err)
+	}
+}
+
+func header(t *testing.T, token string) map[string]interface{} {
+	t.Helper()
+	parsed, _, err := new(jwt.Parser).ParseUnverified(token, jwt.MapClaims{})
+	if err != nil {
+		t.Fatalf("ParseUnverified() error = %v", err)
+	}
+	return parsed.Header
+}
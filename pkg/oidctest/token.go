@@ -0,0 +1,254 @@
+package oidctest
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+type defect int
+
+const (
+	noDefect defect = iota
+	badSignature
+	algNone
+	tamperedPayload
+)
+
+// TokenBuilder builds a signed token step by step:
+//
+//	token := oidctest.NewToken(key).
+//		Subject("user").
+//		Audience("api").
+//		RealmRoles("admin").
+//		ExpiresIn(time.Minute).
+//		MustSign()
+//
+// The broken variants produce tokens a decoder must reject.
+type TokenBuilder struct {
+	key    *Key
+	alg    string
+	header map[string]interface{}
+	claims jwt.MapClaims
+	defect defect
+}
+
+// NewToken starts a token signed by key, issued now and expiring in five
+// minutes.
+func NewToken(key *Key) *TokenBuilder {
+	now := time.Now()
+	return &TokenBuilder{
+		key:    key,
+		alg:    key.Alg,
+		header: map[string]interface{}{"kid": key.Kid},
+		claims: jwt.MapClaims{
+			"iat": now.Unix(),
+			"exp": now.Add(defaultTTL).Unix(),
+		},
+	}
+}
+
+// NewToken starts a token of the realm, signed by its signing key.
+func (r *Realm) NewToken() *TokenBuilder {
+	return NewToken(r.SigningKey()).Issuer(r.Issuer())
+}
+
+// Issuer sets "iss".
+func (b *TokenBuilder) Issuer(iss string) *TokenBuilder {
+	return b.Claim("iss", iss)
+}
+
+// Subject sets "sub".
+func (b *TokenBuilder) Subject(sub string) *TokenBuilder {
+	return b.Claim("sub", sub)
+}
+
+// Audience sets "aud", as a string for a single audience.
+func (b *TokenBuilder) Audience(aud ...string) *TokenBuilder {
+	if len(aud) == 1 {
+		return b.Claim("aud", aud[0])
+	}
+	return b.Claim("aud", aud)
+}
+
+// ID sets "jti".
+func (b *TokenBuilder) ID(jti string) *TokenBuilder {
+	return b.Claim("jti", jti)
+}
+
+// Scope sets the space separated "scope".
+func (b *TokenBuilder) Scope(scopes ...string) *TokenBuilder {
+	return b.Claim("scope", strings.Join(scopes, " "))
+}
+
+// IssuedAt sets "iat".
+func (b *TokenBuilder) IssuedAt(t time.Time) *TokenBuilder {
+	return b.Claim("iat", t.Unix())
+}
+
+// NotBefore sets "nbf".
+func (b *TokenBuilder) NotBefore(t time.Time) *TokenBuilder {
+	return b.Claim("nbf", t.Unix())
+}
+
+// ExpiresAt sets "exp".
+func (b *TokenBuilder) ExpiresAt(t time.Time) *TokenBuilder {
+	return b.Claim("exp", t.Unix())
+}
+
+// ExpiresIn sets "exp" to now plus d. A negative d gives an expired token.
+func (b *TokenBuilder) ExpiresIn(d time.Duration) *TokenBuilder {
+	return b.ExpiresAt(time.Now().Add(d))
+}
+
+// RealmRoles sets the Keycloak "realm_access" roles.
+func (b *TokenBuilder) RealmRoles(roles ...string) *TokenBuilder {
+	return b.Claim("realm_access", map[string]interface{}{"roles": roles})
+}
+
+// ClientRoles adds the Keycloak "resource_access" roles of client.
+func (b *TokenBuilder) ClientRoles(client string, roles ...string) *TokenBuilder {
+	access, _ := b.claims["resource_access"].(map[string]interface{})
+	if access == nil {
+		access = make(map[string]interface{})
+	}
+	access[client] = map[string]interface{}{"roles": roles}
+	return b.Claim("resource_access", access)
+}
+
+// Act sets the RFC 8693 "act" claim to the delegation chain of the actors
+// subs, the current actor first and the earliest one last.
+func (b *TokenBuilder) Act(subs ...string) *TokenBuilder {
+	var act interface{}
+	for i := len(subs) - 1; i >= 0; i-- {
+		actor := map[string]interface{}{"sub": subs[i]}
+		if act != nil {
+			actor["act"] = act
+		}
+		act = actor
+	}
+	return b.Claim("act", act)
+}
+
+// Claim sets any claim. A nil value removes it.
+func (b *TokenBuilder) Claim(name string, value interface{}) *TokenBuilder {
+	if value == nil {
+		delete(b.claims, name)
+	} else {
+		b.claims[name] = value
+	}
+	return b
+}
+
+// Claims sets every claim of claims.
+func (b *TokenBuilder) Claims(claims map[string]interface{}) *TokenBuilder {
+	for name, value := range claims {
+		b.Claim(name, value)
+	}
+	return b
+}
+
+// Header sets any header parameter. A nil value removes it.
+func (b *TokenBuilder) Header(name string, value interface{}) *TokenBuilder {
+	if value == nil {
+		delete(b.header, name)
+	} else {
+		b.header[name] = value
+	}
+	return b
+}
+
+// Kid sets the "kid" header, the kid of the key by default.
+func (b *TokenBuilder) Kid(kid string) *TokenBuilder {
+	return b.Header("kid", kid)
+}
+
+// Alg signs with alg instead of the algorithm of the key, for instance RS512
+// with an RS256 key.
+func (b *TokenBuilder) Alg(alg string) *TokenBuilder {
+	b.alg = alg
+	return b
+}
+
+// WrongKid puts a kid no provider publishes in the header.
+func (b *TokenBuilder) WrongKid() *TokenBuilder {
+	buf := make([]byte, 16)
+	_, _ = rand.Read(buf)
+	return b.Kid("unknown-" + base64.RawURLEncoding.EncodeToString(buf))
+}
+
+// BadSignature corrupts the signature.
+func (b *TokenBuilder) BadSignature() *TokenBuilder {
+	b.defect = badSignature
+	return b
+}
+
+// AlgNone produces an unsigned token with "alg": "none".
+func (b *TokenBuilder) AlgNone() *TokenBuilder {
+	b.defect = algNone
+	return b
+}
+
+// TamperedPayload changes the payload after signing, adding the claim
+// "tampered": true.
+func (b *TokenBuilder) TamperedPayload() *TokenBuilder {
+	b.defect = tamperedPayload
+	return b
+}
+
+// Sign returns the compact serialization of the token.
+func (b *TokenBuilder) Sign() (string, error) {
+	method := jwt.GetSigningMethod(b.alg)
+	if b.alg == b.key.Alg {
+		method = b.key.method
+	}
+	if b.defect == algNone {
+		method = jwt.SigningMethodNone
+	}
+	if method == nil {
+		return "", fmt.Errorf("%w: %q", ErrUnsupportedAlgorithm, b.alg)
+	}
+	t := jwt.NewWithClaims(method, b.claims)
+	for name, value := range b.header {
+		t.Header[name] = value
+	}
+	if b.defect == algNone {
+		return t.SignedString(jwt.UnsafeAllowNoneSignatureType)
+	}
+	token, err := t.SignedString(b.key.Signer)
+	if err != nil {
+		return "", err
+	}
+	parts := strings.Split(token, ".")
+	switch b.defect {
+	case badSignature:
+		sig, _ := jwt.DecodeSegment(parts[2])
+		sig[0] ^= 0xff
+		parts[2] = jwt.EncodeSegment(sig)
+	case tamperedPayload:
+		claims := jwt.MapClaims{"tampered": true}
+		for name, value := range b.claims {
+			claims[name] = value
+		}
+		payload, err := json.Marshal(claims)
+		if err != nil {
+			return "", err
+		}
+		parts[1] = jwt.EncodeSegment(payload)
+	}
+	return strings.Join(parts, "."), nil
+}
+
+// MustSign is Sign panicking on error, for table driven tests.
+func (b *TokenBuilder) MustSign() string {
+	token, err := b.Sign()
+	if err != nil {
+		panic(err)
+	}
+	return token
+}
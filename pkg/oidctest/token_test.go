@@ -0,0 +1,127 @@
+package oidctest
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/marcosgmgm/openid-decode-token/pkg/decoder"
+	"github.com/marcosgmgm/openid-decode-token/pkg/metrics"
+)
+
+func TestTokenBuilder(t *testing.T) {
+	p := NewProvider("test")
+	defer p.Close()
+	r := p.Realm("test")
+	d := decoder.NewJwtDecoder(p.Manager(), decoder.WithAudiences("api"))
+	tests := []struct {
+		name        string
+		token       string
+		wantOutcome string
+	}{
+		{
+			name:        "valid",
+			token:       r.NewToken().Audience("api").MustSign(),
+			wantOutcome: metrics.OutcomeValid,
+		},
+		{
+			name:        "other algorithm of the key",
+			token:       r.NewToken().Audience("api").Alg("RS512").MustSign(),
+			wantOutcome: metrics.OutcomeValid,
+		},
+		{
+			name:        "expired",
+			token:       r.NewToken().Audience("api").ExpiresIn(-time.Minute).MustSign(),
+			wantOutcome: metrics.OutcomeExpired,
+		},
+		{
+			name:        "not yet valid",
+			token:       r.NewToken().Audience("api").NotBefore(time.Now().Add(time.Hour)).MustSign(),
+			wantOutcome: metrics.OutcomeNotYetValid,
+		},
+		{
+			name:        "wrong audience",
+			token:       r.NewToken().Audience("other", "another").MustSign(),
+			wantOutcome: metrics.OutcomeInvalidAudience,
+		},
+		{
+			name:        "bad signature",
+			token:       r.NewToken().Audience("api").BadSignature().MustSign(),
+			wantOutcome: metrics.OutcomeInvalidSignature,
+		},
+		{
+			name:        "tampered payload",
+			token:       r.NewToken().Audience("api").TamperedPayload().MustSign(),
+			wantOutcome: metrics.OutcomeInvalidSignature,
+		},
+		{
+			name:        "alg none",
+			token:       r.NewToken().Audience("api").AlgNone().MustSign(),
+			wantOutcome: metrics.OutcomeInvalidAlgorithm,
+		},
+		{
+			name:        "wrong kid",
+			token:       r.NewToken().Audience("api").WrongKid().MustSign(),
+			wantOutcome: metrics.OutcomeKeyUnavailable,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := d.DecodeAccessTokenClaims(tt.token, "test", jwt.MapClaims{})
+			if got := decoder.Outcome(err); got != tt.wantOutcome {
+				t.Errorf("outcome = %s (%v), want %s", got, err, tt.wantOutcome)
+			}
+		})
+	}
+}
+
+func TestTokenBuilder_Claims(t *testing.T) {
+	k, err := NewKey("ES256")
+	if err != nil {
+		t.Fatal(err)
+	}
+	exp := time.Now().Add(time.Hour).Truncate(time.Second)
+	token := NewToken(k).
+		Issuer("https://idp").
+		Subject("user").
+		ID("jti").
+		Scope("openid", "profile").
+		ExpiresAt(exp).
+		RealmRoles("admin").
+		ClientRoles("app", "read", "write").
+		ClientRoles("other", "read").
+		Act("gateway", "batch").
+		Claim("iat", nil).
+		Claim("custom", 42).
+		Header("typ", "at+jwt").
+		MustSign()
+	claims := jwt.MapClaims{}
+	parsed, _, err := new(jwt.Parser).ParseUnverified(token, claims)
+	if err != nil {
+		t.Fatalf("ParseUnverified() error = %v", err)
+	}
+	if parsed.Header["kid"] != k.Kid || parsed.Header["typ"] != "at+jwt" || parsed.Header["alg"] != "ES256" {
+		t.Errorf("header = %v", parsed.Header)
+	}
+	want := jwt.MapClaims{
+		"iss":          "https://idp",
+		"sub":          "user",
+		"jti":          "jti",
+		"scope":        "openid profile",
+		"exp":          float64(exp.Unix()),
+		"realm_access": map[string]interface{}{"roles": []interface{}{"admin"}},
+		"resource_access": map[string]interface{}{
+			"app":   map[string]interface{}{"roles": []interface{}{"read", "write"}},
+			"other": map[string]interface{}{"roles": []interface{}{"read"}},
+		},
+		"act": map[string]interface{}{
+			"sub": "gateway",
+			"act": map[string]interface{}{"sub": "batch"},
+		},
+		"custom": float64(42),
+	}
+	if !reflect.DeepEqual(claims, want) {
+		t.Errorf("claims = %v, want %v", claims, want)
+	}
+}